@@ -0,0 +1,106 @@
+package emvparser
+
+import "fmt"
+
+// AIP is the Application Interchange Profile (tag 82): two bytes in which the
+// card states the functions it supports, as defined in EMV Book 3 Annex C1.
+// Byte 2 is defined by the contactless specifications (EMV Book C-2). An AIP
+// shorter than two bytes reads as if it were padded with zeros.
+type AIP []byte
+
+// AIPFlag identifies a single bit of the AIP by its byte index and bit mask
+type AIPFlag uint16
+
+// The bits of the AIP, in the order of EMV Book 3 Annex C1 and Book C-2
+const (
+	// Byte 1
+	AIPSDASupported                    AIPFlag = 0<<8 | 0x40
+	AIPDDASupported                    AIPFlag = 0<<8 | 0x20
+	AIPCardholderVerificationSupported AIPFlag = 0<<8 | 0x10
+	AIPTerminalRiskManagementRequired  AIPFlag = 0<<8 | 0x08
+	AIPIssuerAuthenticationSupported   AIPFlag = 0<<8 | 0x04
+	AIPOnDeviceCardholderVerification  AIPFlag = 0<<8 | 0x02
+	AIPCDASupported                    AIPFlag = 0<<8 | 0x01
+
+	// Byte 2, contactless only
+	AIPEMVModeSupported                 AIPFlag = 1<<8 | 0x80
+	AIPRelayResistanceProtocolSupported AIPFlag = 1<<8 | 0x01
+)
+
+// aipFlags lists the defined bits with their meaning, in AIP order
+var aipFlags = []bitMeaning[AIPFlag]{
+	{AIPSDASupported, "SDA supported"},
+	{AIPDDASupported, "DDA supported"},
+	{AIPCardholderVerificationSupported, "Cardholder verification is supported"},
+	{AIPTerminalRiskManagementRequired, "Terminal risk management is to be performed"},
+	{AIPIssuerAuthenticationSupported, "Issuer authentication is supported"},
+	{AIPOnDeviceCardholderVerification, "On device cardholder verification is supported"},
+	{AIPCDASupported, "CDA supported"},
+	{AIPEMVModeSupported, "EMV mode is supported"},
+	{AIPRelayResistanceProtocolSupported, "Relay resistance protocol is supported"},
+}
+
+// NewAIP returns a two-byte AIP with the given bits set, for card simulators
+// and tests
+func NewAIP(flags ...AIPFlag) AIP {
+	return make(AIP, 2).With(flags...)
+}
+
+// With sets the given bits in place and returns the AIP, growing it to two
+// bytes if needed
+func (a AIP) With(flags ...AIPFlag) AIP { return withBits(a, 2, flags) }
+
+// Has reports whether the bit flag is set
+func (a AIP) Has(flag AIPFlag) bool { return hasBit(a, flag) }
+
+// Flags returns the defined bits that are set, in AIP order
+func (a AIP) Flags() []AIPFlag { return setBits(a, aipFlags) }
+
+// String lists the meaning of each bit that is set, separated by semicolons,
+// or returns "No AIP bits set"
+func (a AIP) String() string { return describeBits(a, aipFlags, "No AIP bits set") }
+
+// Format implements fmt.Formatter, so %x and %X print the raw bytes and %s
+// and %v the meaning of the bits
+func (a AIP) Format(s fmt.State, verb rune) { formatBits(s, verb, a, a.String) }
+
+// String returns the meaning of the bit
+func (flag AIPFlag) String() string { return bitName(aipFlags, flag) }
+
+// SDASupported reports byte 1 bit 7
+func (a AIP) SDASupported() bool { return a.Has(AIPSDASupported) }
+
+// DDASupported reports byte 1 bit 6
+func (a AIP) DDASupported() bool { return a.Has(AIPDDASupported) }
+
+// CardholderVerificationSupported reports byte 1 bit 5
+func (a AIP) CardholderVerificationSupported() bool {
+	return a.Has(AIPCardholderVerificationSupported)
+}
+
+// TerminalRiskManagementRequired reports byte 1 bit 4
+func (a AIP) TerminalRiskManagementRequired() bool {
+	return a.Has(AIPTerminalRiskManagementRequired)
+}
+
+// IssuerAuthenticationSupported reports byte 1 bit 3
+func (a AIP) IssuerAuthenticationSupported() bool { return a.Has(AIPIssuerAuthenticationSupported) }
+
+// OnDeviceCardholderVerification reports byte 1 bit 2, set by contactless
+// cards that verify the cardholder on a mobile device
+func (a AIP) OnDeviceCardholderVerification() bool {
+	return a.Has(AIPOnDeviceCardholderVerification)
+}
+
+// CDASupported reports byte 1 bit 1
+func (a AIP) CDASupported() bool { return a.Has(AIPCDASupported) }
+
+// EMVModeSupported reports byte 2 bit 8, set by contactless cards that
+// support EMV mode rather than only mag-stripe mode
+func (a AIP) EMVModeSupported() bool { return a.Has(AIPEMVModeSupported) }
+
+// RelayResistanceProtocolSupported reports byte 2 bit 1, set by contactless
+// cards that support the relay resistance protocol
+func (a AIP) RelayResistanceProtocolSupported() bool {
+	return a.Has(AIPRelayResistanceProtocolSupported)
+}
@@ -0,0 +1,66 @@
+package emvparser
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAIP(t *testing.T) {
+	aip := AIP(mustDecodeHex(t, "3981"))
+
+	tests := []struct {
+		name     string
+		got      bool
+		expected bool
+	}{
+		{"SDASupported", aip.SDASupported(), false},
+		{"DDASupported", aip.DDASupported(), true},
+		{"CardholderVerificationSupported", aip.CardholderVerificationSupported(), true},
+		{"TerminalRiskManagementRequired", aip.TerminalRiskManagementRequired(), true},
+		{"IssuerAuthenticationSupported", aip.IssuerAuthenticationSupported(), false},
+		{"OnDeviceCardholderVerification", aip.OnDeviceCardholderVerification(), false},
+		{"CDASupported", aip.CDASupported(), true},
+		{"EMVModeSupported", aip.EMVModeSupported(), true},
+		{"RelayResistanceProtocolSupported", aip.RelayResistanceProtocolSupported(), true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	expected := "DDA supported; Cardholder verification is supported; Terminal risk management is to be performed; " +
+		"CDA supported; EMV mode is supported; Relay resistance protocol is supported"
+	if got := aip.String(); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+
+	// Contact cards send a single meaningful byte
+	if contact := (AIP{0x5C}); !contact.SDASupported() || contact.EMVModeSupported() {
+		t.Errorf("Unexpected bits for a one-byte AIP: %s", contact)
+	}
+}
+
+func TestNewAIP(t *testing.T) {
+	aip := NewAIP(AIPCardholderVerificationSupported, AIPCDASupported, AIPEMVModeSupported, AIPRelayResistanceProtocolSupported)
+	if got := fmt.Sprintf("%X", aip); got != "1181" {
+		t.Errorf("Expected 1181, got: %s", got)
+	}
+
+	// A built AIP round trips through Marshal and Parse
+	parser := NewEMVParser()
+	encoded, err := parser.Marshal(&EMVData{AIP: aip})
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if got := fmt.Sprintf("%X", encoded); got != "82021181" {
+		t.Errorf("Expected 82021181, got: %s", got)
+	}
+	parsed, err := parser.Parse(encoded)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if !parsed.AIP.RelayResistanceProtocolSupported() || parsed.AIP.DDASupported() {
+		t.Errorf("Unexpected bits after a round trip: %s", parsed.AIP)
+	}
+}
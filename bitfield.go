@@ -0,0 +1,85 @@
+package emvparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bitFlag is implemented by TVRFlag, TSIFlag and AIPFlag, which identify a
+// single bit of a bit field by the byte index in their high byte and the bit
+// mask in their low byte
+type bitFlag interface {
+	~uint16
+}
+
+// bitMeaning pairs a defined bit with its meaning
+type bitMeaning[F bitFlag] struct {
+	flag F
+	name string
+}
+
+// withBits sets flags in b in place and returns it, growing it to size bytes
+// if needed
+func withBits[F bitFlag](b []byte, size int, flags []F) []byte {
+	if len(b) < size {
+		b = append(b, make([]byte, size-len(b))...)
+	}
+	for _, flag := range flags {
+		b[flag>>8] |= byte(flag)
+	}
+	return b
+}
+
+// hasBit reports whether flag is set in b, reading missing bytes as zero
+func hasBit[F bitFlag](b []byte, flag F) bool {
+	i := int(flag >> 8)
+	return i < len(b) && b[i]&byte(flag) != 0
+}
+
+// setBits returns the bits of table that are set in b, in table order
+func setBits[F bitFlag](b []byte, table []bitMeaning[F]) []F {
+	var flags []F
+	for _, f := range table {
+		if hasBit(b, f.flag) {
+			flags = append(flags, f.flag)
+		}
+	}
+	return flags
+}
+
+// describeBits lists the meaning of each bit of table that is set in b,
+// separated by semicolons, or returns none
+func describeBits[F bitFlag](b []byte, table []bitMeaning[F], none string) string {
+	var names []string
+	for _, f := range table {
+		if hasBit(b, f.flag) {
+			names = append(names, f.name)
+		}
+	}
+	if len(names) == 0 {
+		return none
+	}
+	return strings.Join(names, "; ")
+}
+
+// bitName returns the meaning of flag in table, or "RFU"
+func bitName[F bitFlag](table []bitMeaning[F], flag F) string {
+	for _, f := range table {
+		if f.flag == flag {
+			return f.name
+		}
+	}
+	return "RFU"
+}
+
+// formatBits formats the bit field b for fmt. The s, q and v verbs format
+// its description, and the others, such as x and X, the raw bytes, the way
+// they did when the fields were plain []byte.
+func formatBits(s fmt.State, verb rune, b []byte, describe func() string) {
+	switch {
+	case verb == 's' || verb == 'q' || (verb == 'v' && !s.Flag('#')):
+		fmt.Fprintf(s, fmt.FormatString(s, verb), describe())
+	default:
+		fmt.Fprintf(s, fmt.FormatString(s, verb), b)
+	}
+}
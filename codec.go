@@ -0,0 +1,421 @@
+package emvparser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/wadearnold/kernel/tlv"
+)
+
+// EMVMarshaler is the interface implemented by types that can encode
+// themselves into a raw EMV value. Marshal calls MarshalEMV for any
+// emv-tagged field whose type implements it.
+type EMVMarshaler interface {
+	MarshalEMV() ([]byte, error)
+}
+
+// EMVUnmarshaler is the interface implemented by types that can decode a raw
+// EMV value themselves. Unmarshal calls UnmarshalEMV with the value of the
+// data object, which must be copied if it is retained after returning.
+type EMVUnmarshaler interface {
+	UnmarshalEMV([]byte) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*EMVMarshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*EMVUnmarshaler)(nil)).Elem()
+)
+
+// hasCustomCodec reports whether t or a pointer to t implements EMVMarshaler
+// or EMVUnmarshaler
+func hasCustomCodec(t reflect.Type) bool {
+	pt := reflect.PointerTo(t)
+	return t.Implements(marshalerType) || t.Implements(unmarshalerType) ||
+		pt.Implements(marshalerType) || pt.Implements(unmarshalerType)
+}
+
+// structField describes a single emv-tagged field of a struct
+type structField struct {
+	// tag is the EMV tag as an uppercase hex string
+	tag string
+
+	// tagValue is tag in the uint32 form used by package tlv
+	tagValue uint32
+
+	// index is the field index within the struct
+	index int
+
+	// name is the Go field name, used in error messages
+	name string
+
+	// omitEmpty skips the field in Marshal when its value is empty
+	omitEmpty bool
+
+	// template marks a struct field that is encoded as a constructed template
+	template bool
+
+	// decode stores a value in the field, chosen once by its type
+	decode decoderFunc
+}
+
+// structFields holds the emv-tagged fields of a struct type
+type structFields struct {
+	// list holds the fields in declaration order
+	list []structField
+
+	// byTag maps an EMV tag in uint32 form to its position in list
+	byTag map[uint32]int
+
+	// unknown is the index of the TLVList field tagged emv:",unknown", or -1
+	unknown int
+}
+
+// tagOptions holds the options that follow the EMV tag in an emv struct tag
+type tagOptions struct {
+	omitEmpty bool
+	unknown   bool
+}
+
+var tlvListType = reflect.TypeOf(TLVList(nil))
+
+// fieldCache caches the structFields of every struct type seen by Marshal and
+// Unmarshal, keyed by reflect.Type
+var fieldCache sync.Map
+
+// cachedFields returns the emv-tagged fields of t, building them on first use
+func cachedFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.(*structFields)
+}
+
+// typeFields reflects over the emv struct tags of t
+func typeFields(t reflect.Type) *structFields {
+	fields := &structFields{byTag: make(map[uint32]int), unknown: -1}
+
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag, opts := parseEMVTag(sf.Tag.Get("emv"))
+		if opts.unknown && sf.Type == tlvListType {
+			fields.unknown = i
+			continue
+		}
+		if tag == "" {
+			continue
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		fields.byTag[tagValue(tag)] = len(fields.list)
+		fields.list = append(fields.list, structField{
+			tag:       tag,
+			tagValue:  tagValue(tag),
+			index:     i,
+			name:      sf.Name,
+			omitEmpty: opts.omitEmpty,
+			template:  ft.Kind() == reflect.Struct && ft != timeType && !hasCustomCodec(ft),
+			decode:    valueDecoder(sf.Type),
+		})
+	}
+
+	return fields
+}
+
+// parseEMVTag splits an emv struct tag such as "9F02,omitempty" into the EMV
+// tag and its options. A tag of "-" yields an empty EMV tag so the field is
+// skipped.
+func parseEMVTag(structTag string) (tag string, opts tagOptions) {
+	tag, rest, _ := strings.Cut(structTag, ",")
+	if tag == "-" {
+		return "", opts
+	}
+
+	for rest != "" {
+		var opt string
+		opt, rest, _ = strings.Cut(rest, ",")
+		switch opt {
+		case "omitempty":
+			opts.omitEmpty = true
+		case "unknown":
+			opts.unknown = true
+		}
+	}
+
+	return strings.ToUpper(tag), opts
+}
+
+// Unmarshal decodes BER-TLV data into the struct pointed to by v, matching
+// data objects to fields by their emv struct tag.
+//
+// A constructed data object is decoded into a struct field carrying its tag
+// when there is one; otherwise its children are decoded into v itself, the way
+// EMVParser.Parse flattens templates such as 77 and 6F. A []byte field with a
+// constructed tag receives the raw value of the template, and its children are
+// flattened as well. When a tag occurs more than once the last occurrence
+// wins.
+//
+// Data objects without a matching field are appended, in input order, to a
+// TLVList field tagged emv:",unknown" if the struct has one, and ignored
+// otherwise. A template without a field keeps, as its Children, only the
+// children that have no field either, so Marshal writes each data object once:
+// issuer script templates such as 71 and 72 are kept whole, and a template
+// whose children all have fields is dropped.
+//
+// A value that cannot be stored in its field, including an error returned by
+// UnmarshalEMV, is reported as a *DecodeError wrapping the cause.
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal requires a non-nil pointer to a struct, got %T", v)
+	}
+
+	return newTreeDecoder(ParseOptions{}).decodeStruct(data, 0, 1, rv.Elem(), nil)
+}
+
+// decodeStruct fills the fields of the struct v from data, whose first byte
+// sits at offset base of the input, nested depth templates deep. The data is
+// read in place with a tlv.Iterator and fields are found by their uint32 tag,
+// so only data objects without a field allocate. Those are collected in the
+// struct's unknown field and passed to d.unknown.
+//
+// The children of a template without a field are flattened into v, and the
+// template keeps only the children no field consumed, so Marshal writes each
+// data object once. A template whose children were all consumed is dropped.
+//
+// When tree is not nil the data is the value of such a template, and the data
+// objects without a field are appended to tree instead of the unknown field.
+func (d *treeDecoder) decodeStruct(data []byte, base, depth int, v reflect.Value, tree *TLVList) error {
+	fields := cachedFields(v.Type())
+
+	it := d.iterator(data)
+	for {
+		ok, err := d.next(it, base, depth)
+		if err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+
+		i, known := fields.byTag[it.Tag()]
+		var node *TLV
+		if !known {
+			node = &TLV{
+				Tag:    tlv.FormatTag(it.Tag()),
+				Length: len(it.Value()),
+				Value:  it.Value(),
+				Offset: base + it.Offset(),
+				Header: it.Header(),
+			}
+		}
+
+		if tlv.Constructed(it.Tag()) {
+			// Decode the template into its own struct, or flatten its
+			// children into v when there is none. The children of a
+			// flattened template are read as if they were its siblings.
+			fv, children := v, tree
+			if known {
+				f := &fields.list[i]
+				if f.template {
+					fv, children = v.Field(f.index), nil
+					if fv.Kind() == reflect.Ptr {
+						if fv.IsNil() {
+							fv.Set(reflect.New(fv.Type().Elem()))
+						}
+						fv = fv.Elem()
+					}
+				} else if err := d.decodeField(v, f, it.Value()); err != nil {
+					// Other fields receive the raw value of the template
+					return err
+				}
+				d.consumed++
+			} else {
+				children = &node.Children
+			}
+
+			consumed := d.consumed
+			d.enter(it.Tag())
+			err = d.decodeStruct(it.Value(), base+it.Offset()+len(it.Header()), depth+1, fv, children)
+			d.leave()
+			if err != nil {
+				return err
+			}
+
+			if known {
+				continue
+			}
+			if d.consumed > consumed {
+				// Keep only the children left over, re-encoded
+				if len(node.Children) == 0 {
+					continue
+				}
+				node.Value = node.Children.appendTo(nil)
+				node.Length = len(node.Value)
+				node.Header = nil
+			}
+			d.keep(v, fields, node, tree)
+			continue
+		}
+
+		if !known {
+			if d.validate {
+				d.check(node.Tag, it.Value(), node.Offset)
+			}
+			d.keep(v, fields, node, tree)
+			continue
+		}
+
+		f := &fields.list[i]
+		if err := d.decodeField(v, f, it.Value()); err != nil {
+			return err
+		}
+		d.consumed++
+		if d.validate {
+			d.check(f.tag, it.Value(), base+it.Offset())
+		}
+		if d.keepOrder {
+			d.order = append(d.order, f.tag)
+		}
+	}
+}
+
+// decodeField stores value in the field f of the struct v, reporting a
+// failure as a *DecodeError
+func (d *treeDecoder) decodeField(v reflect.Value, f *structField, value []byte) error {
+	if err := f.decode(v.Field(f.index), value, d.registry.format(f.tag)); err != nil {
+		return &DecodeError{Field: f.name, Tag: f.tag, Err: err}
+	}
+	return nil
+}
+
+// keep appends node, a data object without a field, to tree when it is
+// not nil, and otherwise to the unknown field of the struct v, passing it to
+// d.unknown
+func (d *treeDecoder) keep(v reflect.Value, fields *structFields, node *TLV, tree *TLVList) {
+	if tree != nil {
+		*tree = append(*tree, node)
+		return
+	}
+	if fields.unknown >= 0 {
+		extra := v.Field(fields.unknown)
+		extra.Set(reflect.Append(extra, reflect.ValueOf(node)))
+	}
+	if d.unknown != nil {
+		d.unknown(node)
+	}
+	if d.keepOrder {
+		d.order = append(d.order, node.Tag)
+	}
+}
+
+// check records a violation when the value of a data object with tag, found
+// at offset, does not match the format the registry defines for it
+func (d *treeDecoder) check(tag string, value []byte, offset int) {
+	format, ok := d.registry.lookup(tag)
+	if !ok {
+		return
+	}
+	if err := validateValue(value, format); err != nil {
+		d.violations = append(d.violations, &ValidationError{Offset: offset, Tag: tag, Path: d.pathString(), Err: err})
+	}
+}
+
+// Marshal encodes the emv-tagged fields of the struct v (or pointer to struct)
+// as BER-TLV data, in field declaration order.
+//
+// Struct tag options follow encoding/json: "omitempty" skips zero values and
+// a tag of "-" skips the field. The data objects in an emv:",unknown" field
+// are emitted after all other fields. Struct fields are encoded as constructed
+// templates holding the encoding of their own fields. Primitive values are
+// padded according to DefaultTagRegistry. A value that cannot be made valid,
+// or an error returned by MarshalEMV, is reported as an *EncodeError wrapping
+// the cause.
+func Marshal(v any) ([]byte, error) {
+	return AppendMarshal(nil, v)
+}
+
+// AppendMarshal is like Marshal but appends the encoding of v to dst, so hot
+// paths can reuse a buffer
+func AppendMarshal(dst []byte, v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("marshal requires a non-nil struct, got %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("marshal requires a struct, got %T", v)
+	}
+
+	return encodeStruct(dst, rv, DefaultTagRegistry)
+}
+
+// encodeStruct appends the TLV encoding of the fields of the struct v to dst,
+// formatting values according to registry
+func encodeStruct(dst []byte, v reflect.Value, registry *TagRegistry) ([]byte, error) {
+	fields := cachedFields(v.Type())
+
+	for _, f := range fields.list {
+		fv := v.Field(f.index)
+		if f.omitEmpty && isZeroValue(fv) {
+			continue
+		}
+
+		if f.template {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv = reflect.New(fv.Type().Elem())
+				}
+				fv = fv.Elem()
+			}
+
+			if !tlv.Constructed(tagValue(f.tag)) {
+				return nil, fmt.Errorf("field %s: tag %s is not a constructed tag", f.name, f.tag)
+			}
+
+			// Encode the fields in place, then insert the template header
+			start := len(dst)
+			var err error
+			dst, err = encodeStruct(dst, fv, registry)
+			if err != nil {
+				return nil, err
+			}
+			dst = tlv.Wrap(dst, start, tagValue(f.tag))
+			continue
+		}
+
+		format := registry.format(f.tag)
+		value, err := encodeValue(fv, format)
+		if err != nil {
+			return nil, &EncodeError{Field: f.name, Tag: f.tag, Err: err}
+		}
+
+		if len(value) > 0 {
+			// Apply formatting
+			value, err = formatValueForTag(value, format)
+			if err != nil {
+				return nil, &EncodeError{Field: f.name, Tag: f.tag, Err: err}
+			}
+		}
+
+		dst = appendTLV(dst, f.tag, value)
+	}
+
+	if fields.unknown >= 0 {
+		// Re-emit the data objects that had no field
+		dst = v.Field(fields.unknown).Interface().(TLVList).appendTo(dst)
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,319 @@
+package emvparser
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Application entry (61) of a PPSE response
+type testDirectoryEntry struct {
+	AID      []byte `emv:"4F"`
+	Label    string `emv:"50,omitempty"`
+	Priority []byte `emv:"87,omitempty"`
+}
+
+// Proprietary template (A5) of a PPSE response
+type testFCIProprietary struct {
+	Discretionary struct {
+		Entry testDirectoryEntry `emv:"61"`
+	} `emv:"BF0C"`
+}
+
+// PPSE response with nested templates
+type testPPSE struct {
+	FCI struct {
+		DFName      []byte              `emv:"84"`
+		Proprietary *testFCIProprietary `emv:"A5"`
+	} `emv:"6F"`
+}
+
+// Flat authorization request using tag options
+type testAuthorization struct {
+	Cryptogram []byte `emv:"9F26"`
+	ATC        []byte `emv:"9F36"`
+	IAD        []byte `emv:"9F10,omitempty"`
+	Internal   []byte `emv:"-"`
+	Reference  string
+}
+
+func TestUnmarshalNestedTemplates(t *testing.T) {
+	data := mustDecodeHex(t, "6F30840E325041592E5359532E4444463031A51EBF0C1B61194F07A0000000031010500B5649534120435245444954870101")
+
+	var ppse testPPSE
+	if err := Unmarshal(data, &ppse); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+
+	if string(ppse.FCI.DFName) != "2PAY.SYS.DDF01" {
+		t.Errorf("Expected DF name 2PAY.SYS.DDF01, got: %s", ppse.FCI.DFName)
+	}
+	if ppse.FCI.Proprietary == nil {
+		t.Fatalf("Expected the A5 template to be decoded")
+	}
+
+	entry := ppse.FCI.Proprietary.Discretionary.Entry
+	if fmt.Sprintf("%X", entry.AID) != "A0000000031010" || entry.Label != "VISA CREDIT" {
+		t.Errorf("Unexpected directory entry: AID %X, label %q", entry.AID, entry.Label)
+	}
+
+	// Marshaling must reproduce the input
+	encoded, err := Marshal(&ppse)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if !bytesEqual(encoded, data) {
+		t.Errorf("Expected %X, got: %X", data, encoded)
+	}
+}
+
+func TestUnmarshalFlattensUnknownTemplates(t *testing.T) {
+	data := mustDecodeHex(t, "77149F2608D0C669EEB70C58DD9F3602006999020000")
+
+	var auth testAuthorization
+	if err := Unmarshal(data, &auth); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+
+	if hex.EncodeToString(auth.Cryptogram) != "d0c669eeb70c58dd" {
+		t.Errorf("Unexpected cryptogram: %X", auth.Cryptogram)
+	}
+	if hex.EncodeToString(auth.ATC) != "0069" {
+		t.Errorf("Unexpected ATC: %X", auth.ATC)
+	}
+}
+
+func TestUnmarshalTemplateBytes(t *testing.T) {
+	data := mustDecodeHex(t, "77099F2701809F36020069")
+
+	var v struct {
+		Response []byte `emv:"77"`
+		CID      []byte `emv:"9F27"`
+	}
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+
+	if fmt.Sprintf("%X", v.Response) != "9F2701809F36020069" {
+		t.Errorf("Expected the raw template value, got: %X", v.Response)
+	}
+	if fmt.Sprintf("%X", v.CID) != "80" {
+		t.Errorf("Expected the template's children to be flattened, got CID: %X", v.CID)
+	}
+}
+
+func TestUnmarshalUnknownTemplateRoundTrip(t *testing.T) {
+	data := mustDecodeHex(t, "77099F2701809F36020069")
+
+	var v struct {
+		CID   []byte  `emv:"9F27"`
+		Other TLVList `emv:",unknown"`
+	}
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+	if fmt.Sprintf("%X", v.CID) != "80" {
+		t.Errorf("Expected the template's children to be flattened, got CID: %X", v.CID)
+	}
+
+	// 77 keeps only 9F36, so 9F27 is written once
+	encoded, err := Marshal(&v)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if got := fmt.Sprintf("%X", encoded); got != "9F270180"+"77059F36020069" {
+		t.Errorf("Expected 9F270180 77059F36020069, got: %s", got)
+	}
+}
+
+func TestMarshalTagOptions(t *testing.T) {
+	auth := testAuthorization{
+		Cryptogram: []byte{0xD0, 0xC6, 0x69, 0xEE, 0xB7, 0x0C, 0x58, 0xDD},
+		Internal:   []byte{0x01},
+		Reference:  "ignored",
+	}
+
+	encoded, err := Marshal(auth)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+
+	// 9F36 has no omitempty so it is emitted empty, 9F10 is omitted and
+	// the "-" and untagged fields are skipped
+	expected := "9F2608D0C669EEB70C58DD9F3600"
+	if fmt.Sprintf("%X", encoded) != expected {
+		t.Errorf("Expected %s, got: %X", expected, encoded)
+	}
+}
+
+func TestAppendMarshal(t *testing.T) {
+	data := mustDecodeHex(t, "6F30840E325041592E5359532E4444463031A51EBF0C1B61194F07A0000000031010500B5649534120435245444954870101")
+
+	var ppse testPPSE
+	if err := Unmarshal(data, &ppse); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+
+	// The encoding is appended after the existing bytes
+	buf := make([]byte, 0, 128)
+	buf = append(buf, 0x01, 0x02)
+	encoded, err := AppendMarshal(buf, &ppse)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if !bytesEqual(encoded[:2], []byte{0x01, 0x02}) || !bytesEqual(encoded[2:], data) {
+		t.Errorf("Expected 0102%X, got: %X", data, encoded)
+	}
+	if &encoded[0] != &buf[:1][0] {
+		t.Errorf("Expected the buffer to be reused")
+	}
+
+	// Reusing the buffer gives the same result
+	again, err := AppendMarshal(encoded[:0], &ppse)
+	if err != nil || !bytesEqual(again, data) {
+		t.Errorf("Expected %X, got: %X (%v)", data, again, err)
+	}
+}
+
+func TestMarshalRejectsPrimitiveTemplateTag(t *testing.T) {
+	var v struct {
+		Template struct {
+			ATC []byte `emv:"9F36"`
+		} `emv:"9F10"`
+	}
+
+	if _, err := Marshal(v); err == nil {
+		t.Errorf("Expected an error for a struct field with a primitive tag")
+	}
+}
+
+func TestUnmarshalRequiresStructPointer(t *testing.T) {
+	var auth testAuthorization
+	if err := Unmarshal(nil, auth); err == nil {
+		t.Errorf("Expected an error when unmarshaling into a non-pointer")
+	}
+}
+
+// CVM Results (9F34) decoded into its three components
+type testCVMResults struct {
+	Method    byte
+	Condition byte
+	Result    byte
+}
+
+func (c testCVMResults) MarshalEMV() ([]byte, error) {
+	return []byte{c.Method, c.Condition, c.Result}, nil
+}
+
+var errCVMLength = errors.New("CVM Results must be 3 bytes")
+
+func (c *testCVMResults) UnmarshalEMV(value []byte) error {
+	if len(value) != 3 {
+		return fmt.Errorf("%w, got %d", errCVMLength, len(value))
+	}
+	c.Method, c.Condition, c.Result = value[0], value[1], value[2]
+	return nil
+}
+
+// Issuer Application Data kept as a hex string
+type testIAD string
+
+func (iad testIAD) MarshalEMV() ([]byte, error) {
+	return hex.DecodeString(string(iad))
+}
+
+func (iad *testIAD) UnmarshalEMV(value []byte) error {
+	*iad = testIAD(fmt.Sprintf("%X", value))
+	return nil
+}
+
+type testCustomCodec struct {
+	CVM    testCVMResults  `emv:"9F34"`
+	CVMPtr *testCVMResults `emv:"9F33,omitempty"`
+	IAD    testIAD         `emv:"9F10"`
+}
+
+func TestCustomFieldCodecs(t *testing.T) {
+	data := mustDecodeHex(t, "9F34031E03009F33034103029F100706011203900000")
+
+	var v testCustomCodec
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+
+	if v.CVM != (testCVMResults{Method: 0x1E, Condition: 0x03, Result: 0x00}) {
+		t.Errorf("Unexpected CVM Results: %+v", v.CVM)
+	}
+	if v.CVMPtr == nil || v.CVMPtr.Method != 0x41 {
+		t.Errorf("Expected the pointer field to be allocated and decoded, got: %+v", v.CVMPtr)
+	}
+	if v.IAD != "06011203900000" {
+		t.Errorf("Unexpected IAD: %s", v.IAD)
+	}
+
+	encoded, err := Marshal(&v)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if !bytesEqual(encoded, data) {
+		t.Errorf("Expected %X, got: %X", data, encoded)
+	}
+}
+
+func TestCustomFieldCodecErrors(t *testing.T) {
+	var v testCustomCodec
+	err := Unmarshal(mustDecodeHex(t, "9F34021E03"), &v)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Field != "CVM" || decodeErr.Tag != "9F34" {
+		t.Errorf("Expected a *DecodeError for field CVM, got: %v", err)
+	}
+	if !errors.Is(err, errCVMLength) {
+		t.Errorf("Expected the UnmarshalEMV error to be wrapped, got: %v", err)
+	}
+
+	_, err = Marshal(testCustomCodec{IAD: "XYZ"})
+	var encodeErr *EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Field != "IAD" || encodeErr.Tag != "9F10" {
+		t.Errorf("Expected an *EncodeError for field IAD, got: %v", err)
+	}
+	var hexErr hex.InvalidByteError
+	if !errors.As(err, &hexErr) {
+		t.Errorf("Expected the MarshalEMV error to be wrapped, got: %v", err)
+	}
+}
+
+type testUnknownCapture struct {
+	ATC      []byte `emv:"9F36"`
+	Response struct {
+		CID   []byte  `emv:"9F27"`
+		Other TLVList `emv:",unknown"`
+	} `emv:"77"`
+	Other TLVList `emv:",unknown"`
+}
+
+func TestUnmarshalUnknownField(t *testing.T) {
+	data := mustDecodeHex(t, "9F360200699F1A020840770A"+"9F2701809F3303E0F8C8"+"9505"+"0000008000")
+
+	var v testUnknownCapture
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+
+	if len(v.Other) != 2 || v.Other[0].Tag != "9F1A" || v.Other[1].Tag != "95" {
+		t.Fatalf("Expected 9F1A and 95 in the top-level unknown field, got: %d tags", len(v.Other))
+	}
+	if len(v.Response.Other) != 1 || v.Response.Other[0].Tag != "9F33" {
+		t.Fatalf("Expected 9F33 in the template's unknown field, got: %d tags", len(v.Response.Other))
+	}
+
+	// Unknown tags are re-emitted after the known fields
+	encoded, err := Marshal(&v)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	expected := "9F36020069770A9F2701809F3303E0F8C89F1A02084095050000008000"
+	if fmt.Sprintf("%X", encoded) != expected {
+		t.Errorf("Expected %s, got: %X", expected, encoded)
+	}
+}
@@ -0,0 +1,165 @@
+package emvparser
+
+import (
+	"fmt"
+	"slices"
+)
+
+// The edit methods below change a TLV tree in place, selecting data objects
+// with the query paths of TLVList.Query. Every other data object keeps its
+// position, and the Value and Length of the templates enclosing an edit are
+// recomputed, so MarshalRaw still reproduces the untouched parts of the input
+// byte for byte. Offsets keep referring to the decoded input; data objects
+// added by an edit have offset 0.
+
+// Set sets the value of every data object at path. When there is none, a data
+// object with the last tag of the path is appended to the single template at
+// the rest of the path, or to the list itself for a single-step path. The
+// value of a constructed tag is decoded into Children.
+func (l *TLVList) Set(path string, value []byte) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	locs := l.locate(steps, nil, "", nil)
+	for _, loc := range locs {
+		if err := loc.node().setValue(value); err != nil {
+			return err
+		}
+		updateTemplates(loc.ancestors)
+	}
+	if len(locs) > 0 {
+		return nil
+	}
+
+	// Add the data object, which can only be the first of its tag
+	last := steps[len(steps)-1]
+	if last.index > 0 {
+		return fmt.Errorf("%w: %s", ErrNoMatch, path)
+	}
+	node := &TLV{Tag: last.tag}
+	if err := node.setValue(value); err != nil {
+		return err
+	}
+
+	siblings, ancestors, err := l.template(steps[:len(steps)-1], path)
+	if err != nil {
+		return err
+	}
+	*siblings = append(*siblings, node)
+	updateTemplates(ancestors)
+	return nil
+}
+
+// Delete removes every data object at path, together with its children. A
+// path that matches nothing is not an error.
+func (l *TLVList) Delete(path string) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	// Remove the last matches first, so the indexes of the others stay valid
+	locs := l.locate(steps, nil, "", nil)
+	for i := len(locs) - 1; i >= 0; i-- {
+		loc := locs[i]
+		*loc.siblings = slices.Delete(*loc.siblings, loc.index, loc.index+1)
+		updateTemplates(loc.ancestors)
+	}
+	return nil
+}
+
+// InsertAfter inserts node after the single data object at path, as its
+// sibling
+func (l *TLVList) InsertAfter(path string, node *TLV) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	loc, err := l.locateOne(steps, path)
+	if err != nil {
+		return err
+	}
+
+	*loc.siblings = slices.Insert(*loc.siblings, loc.index+1, node)
+	updateTemplates(loc.ancestors)
+	return nil
+}
+
+// Replace replaces the single data object at path with node
+func (l *TLVList) Replace(path string, node *TLV) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	loc, err := l.locateOne(steps, path)
+	if err != nil {
+		return err
+	}
+
+	(*loc.siblings)[loc.index] = node
+	updateTemplates(loc.ancestors)
+	return nil
+}
+
+// locateOne returns the location of the single data object at steps. path
+// is the full path being edited, used in errors.
+func (l *TLVList) locateOne(steps []pathStep, path string) (location, error) {
+	locs := l.locate(steps, nil, "", nil)
+	switch {
+	case len(locs) == 0:
+		return location{}, fmt.Errorf("%w: %s", ErrNoMatch, path)
+	case len(locs) > 1:
+		return location{}, fmt.Errorf("%w: %s", ErrAmbiguousPath, path)
+	}
+	return locs[0], nil
+}
+
+// template returns the children of the single constructed data object at
+// steps and the templates enclosing them, or the list itself when steps is
+// empty. path is the full path being edited, used in errors.
+func (l *TLVList) template(steps []pathStep, path string) (*TLVList, []*TLV, error) {
+	if len(steps) == 0 {
+		return l, nil, nil
+	}
+
+	loc, err := l.locateOne(steps, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parent := loc.node()
+	if !parent.Constructed() {
+		return nil, nil, fmt.Errorf("tag %s in %s is not a constructed tag", parent.Tag, path)
+	}
+	return &parent.Children, append(loc.ancestors, parent), nil
+}
+
+// setValue replaces the value of the data object, decoding the children of
+// a constructed tag from it
+func (t *TLV) setValue(value []byte) error {
+	var children TLVList
+	if t.Constructed() {
+		var err error
+		children, err = DecodeTree(value)
+		if err != nil {
+			return fmt.Errorf("tag %s: %w", t.Tag, err)
+		}
+	}
+
+	t.Value = value
+	t.Length = len(value)
+	t.Children = children
+	return nil
+}
+
+// updateTemplates recomputes the Value and Length of templates, whose
+// children have changed, from the innermost outwards
+func updateTemplates(templates []*TLV) {
+	for i := len(templates) - 1; i >= 0; i-- {
+		template := templates[i]
+		template.Value = template.Children.appendRawTo(nil)
+		template.Length = len(template.Value)
+	}
+}
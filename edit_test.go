@@ -0,0 +1,156 @@
+package emvparser
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEditTLVTree(t *testing.T) {
+	// DE55 with terminal country code, track 2 and CVM results
+	const de55 = "9F1A020840" + "57084111111111111111" + "9F34031E0300"
+
+	tests := []struct {
+		name     string
+		edit     func(*TLVList) error
+		expected string
+	}{
+		{
+			"set",
+			func(l *TLVList) error { return l.Set("9F1A", []byte{0x08, 0x26}) },
+			"9F1A020826" + "57084111111111111111" + "9F34031E0300",
+		},
+		{
+			"set a missing tag",
+			func(l *TLVList) error { return l.Set("9F35", []byte{0x22}) },
+			de55 + "9F350122",
+		},
+		{
+			"delete",
+			func(l *TLVList) error { return l.Delete("57") },
+			"9F1A020840" + "9F34031E0300",
+		},
+		{
+			"delete a missing tag",
+			func(l *TLVList) error { return l.Delete("5A") },
+			de55,
+		},
+		{
+			"insert after",
+			func(l *TLVList) error { return l.InsertAfter("9F1A", &TLV{Tag: "9F35", Value: []byte{0x22}}) },
+			"9F1A020840" + "9F350122" + "57084111111111111111" + "9F34031E0300",
+		},
+		{
+			"replace",
+			func(l *TLVList) error { return l.Replace("57", &TLV{Tag: "5A", Value: []byte{0x41, 0x11}}) },
+			"9F1A020840" + "5A024111" + "9F34031E0300",
+		},
+	}
+
+	for _, tt := range tests {
+		nodes, err := DecodeTree(mustDecodeHex(t, de55))
+		if err != nil {
+			t.Fatalf("%s: error decoding TLV tree: %v", tt.name, err)
+		}
+
+		if err := tt.edit(&nodes); err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.name, err)
+			continue
+		}
+		if raw := hex.EncodeToString(nodes.MarshalRaw()); !strings.EqualFold(raw, tt.expected) {
+			t.Errorf("%s: expected %s, got: %s", tt.name, tt.expected, raw)
+		}
+	}
+}
+
+func TestEditNestedTemplate(t *testing.T) {
+	// 77 with a non-minimal length, holding 9F27 and 9F36
+	const data = "77810A9F278101809F36020001"
+
+	tests := []struct {
+		name     string
+		edit     func(*TLVList) error
+		expected string
+	}{
+		{
+			// The length of 77 does not change, so its header is kept
+			"set",
+			func(l *TLVList) error { return l.Set("77/9F36", []byte{0x00, 0x02}) },
+			"77810A9F278101809F36020002",
+		},
+		{
+			"set a missing tag",
+			func(l *TLVList) error { return l.Set("77/9F10", []byte{0x01}) },
+			"770E9F278101809F360200019F100101",
+		},
+		{
+			"delete",
+			func(l *TLVList) error { return l.Delete("77/9F27") },
+			"77059F36020001",
+		},
+		{
+			"insert after",
+			func(l *TLVList) error { return l.InsertAfter("77/9F27", &TLV{Tag: "9F26", Value: []byte{0x01}}) },
+			"770E9F278101809F2601019F36020001",
+		},
+	}
+
+	for _, tt := range tests {
+		nodes, err := DecodeTree(mustDecodeHex(t, data))
+		if err != nil {
+			t.Fatalf("%s: error decoding TLV tree: %v", tt.name, err)
+		}
+
+		if err := tt.edit(&nodes); err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.name, err)
+			continue
+		}
+		if raw := hex.EncodeToString(nodes.MarshalRaw()); !strings.EqualFold(raw, tt.expected) {
+			t.Errorf("%s: expected %s, got: %s", tt.name, tt.expected, raw)
+		}
+
+		// The template stays consistent with its children
+		if template := nodes[0]; template.Length != len(template.Value) || hex.EncodeToString(template.Value) != hex.EncodeToString(template.Children.MarshalRaw()) {
+			t.Errorf("%s: expected 77 to hold %X, got: %X (length %d)", tt.name, template.Children.MarshalRaw(), template.Value, template.Length)
+		}
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	// Two 61 entries and a primitive 9F27
+	nodes, err := DecodeTree(mustDecodeHex(t, "61034F0101"+"61034F0102"+"9F270180"))
+	if err != nil {
+		t.Fatalf("Error decoding TLV tree: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"insert after a missing tag", nodes.InsertAfter("5A", &TLV{Tag: "9F35"}), ErrNoMatch},
+		{"replace an ambiguous path", nodes.Replace("61/4F", &TLV{Tag: "4F"}), ErrAmbiguousPath},
+		{"set in an ambiguous template", nodes.Set("61/50", []byte("VISA")), ErrAmbiguousPath},
+		{"set in a missing template", nodes.Set("77/9F36", []byte{0x00, 0x01}), ErrNoMatch},
+		{"set a later occurrence", nodes.Set("9F35[1]", []byte{0x22}), ErrNoMatch},
+		{"delete with a bad path", nodes.Delete("77/"), ErrInvalidPath},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.kind) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, tt.err)
+		}
+	}
+
+	if err := nodes.Set("9F27/9F36", []byte{0x00, 0x01}); err == nil {
+		t.Errorf("Expected an error adding a tag to a primitive data object")
+	}
+
+	// An index selects a single entry
+	if err := nodes.Replace("61[1]/4F", &TLV{Tag: "4F", Value: []byte{0x03}}); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if raw := hex.EncodeToString(nodes.MarshalRaw()); !strings.EqualFold(raw, "61034F010161034F01039F270180") {
+		t.Errorf("Expected only the second entry to change, got: %s", raw)
+	}
+}
@@ -1,35 +1,118 @@
 package emvparser
 
 import (
-	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"reflect"
+
+	"github.com/wadearnold/kernel/tlv"
 )
 
 // EMVData represents a parsed EMV record with fields mapped to EMV tags
 type EMVData struct {
-	ResponseMessageTemplate       []byte `emv:"77" json:"responseMessageTemplate1"`
-	AIP                           []byte `emv:"82" json:"applicationInterchangeProfile"`
-	TrackData                     []byte `emv:"57" json:"track2EquivalentData"`
-	CardholderName                string `emv:"5F20" json:"cardholderName"`
-	ApplicationExpDate            []byte `emv:"5F24" json:"applicationExpirationDate"`
-	IssuerAppData                 []byte `emv:"9F10" json:"issuerApplicationData"`
-	PinTryCounter                 []byte `emv:"9F17" json:"pinTryCounter"`
-	TransactionStatusInfo         []byte `emv:"9F6E" json:"transactionStatusInformation"`
-	CardTransactionQualifier      []byte `emv:"9F6C" json:"cardTransactionQualifier"`
-	UnpredictableNumber           []byte `emv:"9F37" json:"unpredictableNumber"`
-	ApplicationCryptogram         []byte `emv:"9F26" json:"applicationCryptogram"`
-	IssuerAuthData                []byte `emv:"91" json:"issuerAuthenticationData"`
-	PanSequenceNumber             []byte `emv:"5F34" json:"panSequenceNumber"`
-	CryptogramInformationData     []byte `emv:"9F47" json:"cryptogramInformationData"`
-	IntegredCircuitLevelResults   []byte `emv:"9F27" json:"integratedCircuitLevelResults"`
-	ApplicationIdentifier         []byte `emv:"4F" json:"applicationIdentifier"`
-	ApplicationLabel              string `emv:"50" json:"applicationLabel"`
-	ApplicationPriorityIndicator  []byte `emv:"87" json:"applicationPriorityIndicator"`
-	ApplicationTransactionCounter []byte `emv:"9F36" json:"applicationTransactionCounter"`
-	FileControlInformation        []byte `emv:"6F" json:"fileControlInformation"`
-	DedicatedFileName             []byte `emv:"84" json:"dedicatedFileName"`
+	ResponseMessageTemplate        []byte `emv:"77" json:"responseMessageTemplateFormat2"`
+	AIP                            AIP    `emv:"82" json:"applicationInterchangeProfile"`
+	TrackData                      []byte `emv:"57" json:"track2EquivalentData"`
+	CardholderName                 string `emv:"5F20" json:"cardholderName"`
+	ApplicationExpDate             []byte `emv:"5F24" json:"applicationExpirationDate"`
+	IssuerAppData                  []byte `emv:"9F10" json:"issuerApplicationData"`
+	PinTryCounter                  []byte `emv:"9F17" json:"pinTryCounter"`
+	FormFactorIndicator            []byte `emv:"9F6E" json:"formFactorIndicator"`
+	CardTransactionQualifier       []byte `emv:"9F6C" json:"cardTransactionQualifier"`
+	UnpredictableNumber            []byte `emv:"9F37" json:"unpredictableNumber"`
+	ApplicationCryptogram          []byte `emv:"9F26" json:"applicationCryptogram"`
+	IssuerAuthData                 []byte `emv:"91" json:"issuerAuthenticationData"`
+	PanSequenceNumber              []byte `emv:"5F34" json:"panSequenceNumber"`
+	CryptogramInformationData      []byte `emv:"9F27" json:"cryptogramInformationData"`
+	ICCPublicKeyExponent           []byte `emv:"9F47" json:"iccPublicKeyExponent"`
+	ApplicationIdentifier          []byte `emv:"4F" json:"applicationIdentifier"`
+	ApplicationLabel               string `emv:"50" json:"applicationLabel"`
+	ApplicationPriorityIndicator   []byte `emv:"87" json:"applicationPriorityIndicator"`
+	ApplicationTransactionCounter  []byte `emv:"9F36" json:"applicationTransactionCounter"`
+	FileControlInformation         []byte `emv:"6F" json:"fileControlInformation"`
+	DedicatedFileName              []byte `emv:"84" json:"dedicatedFileName"`
+	AmountAuthorized               []byte `emv:"9F02" json:"amountAuthorizedNumeric"`
+	AmountOther                    []byte `emv:"9F03" json:"amountOtherNumeric"`
+	AmountAuthorizedBinary         []byte `emv:"81" json:"amountAuthorizedBinary"`
+	TransactionDate                []byte `emv:"9A" json:"transactionDate"`
+	TransactionTime                []byte `emv:"9F21" json:"transactionTime"`
+	TransactionType                []byte `emv:"9C" json:"transactionType"`
+	TransactionCurrencyCode        []byte `emv:"5F2A" json:"transactionCurrencyCode"`
+	TransactionCurrencyExponent    []byte `emv:"5F36" json:"transactionCurrencyExponent"`
+	TransactionSequenceCounter     []byte `emv:"9F41" json:"transactionSequenceCounter"`
+	TerminalCountryCode            []byte `emv:"9F1A" json:"terminalCountryCode"`
+	TerminalCapabilities           []byte `emv:"9F33" json:"terminalCapabilities"`
+	AdditionalTerminalCapabilities []byte `emv:"9F40" json:"additionalTerminalCapabilities"`
+	TerminalType                   []byte `emv:"9F35" json:"terminalType"`
+	TerminalVerificationResults    TVR    `emv:"95" json:"terminalVerificationResults"`
+	TransactionStatusInformation   TSI    `emv:"9B" json:"tsi"`
+	TerminalIdentification         string `emv:"9F1C" json:"terminalIdentification"`
+	TerminalFloorLimit             []byte `emv:"9F1B" json:"terminalFloorLimit"`
+	IFDSerialNumber                string `emv:"9F1E" json:"interfaceDeviceSerialNumber"`
+	TerminalApplicationID          []byte `emv:"9F06" json:"applicationIdentifierTerminal"`
+	TerminalApplicationVersion     []byte `emv:"9F09" json:"applicationVersionNumberTerminal"`
+	ApplicationVersionNumber       []byte `emv:"9F08" json:"applicationVersionNumberICC"`
+	CVMResults                     []byte `emv:"9F34" json:"cardholderVerificationMethodResults"`
+	CVMList                        []byte `emv:"8E" json:"cardholderVerificationMethodList"`
+	AcquirerIdentifier             []byte `emv:"9F01" json:"acquirerIdentifier"`
+	MerchantCategoryCode           []byte `emv:"9F15" json:"merchantCategoryCode"`
+	MerchantIdentifier             string `emv:"9F16" json:"merchantIdentifier"`
+	MerchantNameAndLocation        string `emv:"9F4E" json:"merchantNameAndLocation"`
+	POSEntryMode                   []byte `emv:"9F39" json:"pointOfServiceEntryMode"`
+	ApplicationPAN                 []byte `emv:"5A" json:"applicationPrimaryAccountNumber"`
+	ApplicationEffectiveDate       []byte `emv:"5F25" json:"applicationEffectiveDate"`
+	IssuerCountryCode              []byte `emv:"5F28" json:"issuerCountryCode"`
+	ServiceCode                    []byte `emv:"5F30" json:"serviceCode"`
+	ApplicationUsageControl        []byte `emv:"9F07" json:"applicationUsageControl"`
+	IssuerActionCodeDefault        []byte `emv:"9F0D" json:"issuerActionCodeDefault"`
+	IssuerActionCodeDenial         []byte `emv:"9F0E" json:"issuerActionCodeDenial"`
+	IssuerActionCodeOnline         []byte `emv:"9F0F" json:"issuerActionCodeOnline"`
+	CDOL1                          []byte `emv:"8C" json:"cardRiskManagementDataObjectList1"`
+	CDOL2                          []byte `emv:"8D" json:"cardRiskManagementDataObjectList2"`
+	ApplicationFileLocator         []byte `emv:"94" json:"applicationFileLocator"`
+	PDOL                           []byte `emv:"9F38" json:"processingOptionsDataObjectList"`
+	ApplicationPreferredName       string `emv:"9F12" json:"applicationPreferredName"`
+	LanguagePreference             string `emv:"5F2D" json:"languagePreference"`
+	IssuerCodeTableIndex           []byte `emv:"9F11" json:"issuerCodeTableIndex"`
+	ApplicationCurrencyCode        []byte `emv:"9F42" json:"applicationCurrencyCode"`
+	AuthorizationCode              string `emv:"89" json:"authorizationCode"`
+	AuthorizationResponseCode      string `emv:"8A" json:"authorizationResponseCode"`
+	SignedDynamicApplicationData   []byte `emv:"9F4B" json:"signedDynamicApplicationData"`
+	ICCDynamicNumber               []byte `emv:"9F4C" json:"iccDynamicNumber"`
+	LastOnlineATCRegister          []byte `emv:"9F13" json:"lastOnlineApplicationTransactionCounterRegister"`
+	Track1DiscretionaryData        string `emv:"9F1F" json:"track1DiscretionaryData"`
+	Track2DiscretionaryData        []byte `emv:"9F20" json:"track2DiscretionaryData"`
+	DataAuthenticationCode         []byte `emv:"9F45" json:"dataAuthenticationCode"`
+
+	// Deprecated: TransactionStatusInfo holds the Form Factor Indicator
+	// (9F6E), not the Transaction Status Information. Parse copies
+	// FormFactorIndicator into it; use FormFactorIndicator, or
+	// TransactionStatusInformation for tag 9B.
+	TransactionStatusInfo []byte `emv:"-" json:"-"`
+
+	// Deprecated: IntegredCircuitLevelResults holds the Cryptogram
+	// Information Data (9F27). Parse copies CryptogramInformationData into
+	// it, and Marshal emits it as 9F27 when CryptogramInformationData is
+	// empty; use CryptogramInformationData.
+	IntegredCircuitLevelResults []byte `emv:"-" json:"-"`
+
+	// Extra holds the data objects that have no field above, in input order.
+	// Marshal emits them after the fields.
+	Extra TLVList `emv:",unknown" json:"extra,omitempty"`
+
+	// Warnings lists the leniencies applied by Parse in ParseLenient mode
+	Warnings []*ParseError `json:"-"`
+
+	// Violations lists the values found by Parse that do not match the
+	// format of their tag, when the parser was created WithValidation
+	Violations []*ValidationError `json:"-"`
+
+	// order lists the primitive tags in the order Parse found them
+	order []string
+
+	// registry is the TagRegistry of the parser that filled the data, nil
+	// for DefaultTagRegistry
+	registry *TagRegistry
 }
 
 // EMVTagFormat defines the expected format for a specific EMV tag
@@ -40,45 +123,176 @@ type EMVTagFormat struct {
 	// MaxLength is the maximum length in bytes (0 means no maximum)
 	MaxLength int
 
-	// PadLeft indicates whether to pad on the left with zeros (true) or right (false)
+	// PadLeft indicates whether to pad b values on the left with zeros (true)
+	// or right (false). Other formats are padded as their format requires.
 	PadLeft bool
 
-	// Format is an optional format spec used for special cases
+	// Format is the EMV data format of the value: a, an, ans, b, cn or n, or
+	// var for templates. It decides how typed struct fields are encoded.
 	Format string
 
-	// Description provides a human-readable description of the tag
+	// Source is where the data element originates: ICC, Terminal or Issuer
+	Source string
+
+	// Templates lists the templates the data element may appear in, empty
+	// when it is not carried inside a template
+	Templates []string
+
+	// Description provides the name of the data element
 	Description string
 
 	// DE55 indicates whether the tag should be included in the DE55 data element
 	DE55 bool
 }
 
-// EMVTagFormats maps EMV tags to their expected format
+// EMVTagFormats maps EMV tags to their expected format. It holds the data
+// elements of EMV Book 3 Annex A, the kernel 3 card data used by EMVData and
+// the kernel 2 data elements that appear in contactless transactions.
+//
+// Deprecated: The map is copied into DefaultTagRegistry when the package is
+// initialised, and the parser only reads the registry, so later changes to
+// the map have no effect. Register custom formats in a registry created with
+// NewTagRegistry(DefaultTagRegistry) and pass it to WithTagRegistry.
 var EMVTagFormats = map[string]EMVTagFormat{
-	"4F":      {MinLength: 5, MaxLength: 16, PadLeft: false, Description: "Application Identifier (AID)", DE55: false},
-	"50":      {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "Application Label", DE55: false},
-	"57":      {MinLength: 0, MaxLength: 37, PadLeft: false, Description: "Track 2 Equivalent Data", DE55: false},
-	"5F20":    {MinLength: 0, MaxLength: 26, PadLeft: false, Description: "Cardholder Name", DE55: false},
-	"5F24":    {MinLength: 3, MaxLength: 3, PadLeft: true, Description: "Application Expiration Date", DE55: false},
-	"82":      {MinLength: 2, MaxLength: 2, PadLeft: true, Description: "Application Interchange Profile", DE55: true},
-	"84":      {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "Dedicated File Name", DE55: false},
-	"87":      {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "Application Priority Indicator", DE55: false},
-	"9F02":    {MinLength: 6, MaxLength: 6, PadLeft: true, Description: "Amount, Authorized (Numeric)", DE55: true},
-	"9F03":    {MinLength: 6, MaxLength: 6, PadLeft: true, Description: "Amount, Other (Numeric)", DE55: true},
-	"9F10":    {MinLength: 0, MaxLength: 32, PadLeft: false, Description: "Issuer Application Data", DE55: true},
-	"9F26":    {MinLength: 8, MaxLength: 8, PadLeft: true, Description: "Application Cryptogram", DE55: true},
-	"9F27":    {MinLength: 1, MaxLength: 1, PadLeft: true, Description: "Cryptogram Information Data", DE55: true},
-	"9F36":    {MinLength: 2, MaxLength: 2, PadLeft: true, Description: "Application Transaction Counter", DE55: true},
-	"9F37":    {MinLength: 4, MaxLength: 4, PadLeft: true, Description: "Unpredictable Number", DE55: true},
-	"95":      {MinLength: 5, MaxLength: 5, PadLeft: false, Description: "Terminal Verification Results", DE55: true},
-	"77":      {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "Response Message Template", DE55: false},
-	"6F":      {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "File Control Information (FCI) Template", DE55: false},
-	"BF0C":    {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "File Control Information (Proprietary Template)", DE55: false},
-	"A5":      {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "File Control Information (FCI) Issuer Discretionary Data", DE55: false},
-	"DEFAULT": {MinLength: 0, MaxLength: 0, PadLeft: false, Description: "Default Tag Format"},
+	"42":      {MinLength: 3, MaxLength: 3, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"BF0C"}, Description: "Issuer Identification Number (IIN)", DE55: false},
+	"4F":      {MinLength: 5, MaxLength: 16, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"61"}, Description: "Application Identifier (AID) - card", DE55: false},
+	"50":      {MinLength: 1, MaxLength: 16, PadLeft: false, Format: "ans", Source: "ICC", Templates: []string{"61", "A5"}, Description: "Application Label", DE55: false},
+	"57":      {MinLength: 0, MaxLength: 19, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Track 2 Equivalent Data", DE55: false},
+	"5A":      {MinLength: 0, MaxLength: 10, PadLeft: false, Format: "cn", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Primary Account Number (PAN)", DE55: false},
+	"5F20":    {MinLength: 2, MaxLength: 26, PadLeft: false, Format: "ans", Source: "ICC", Templates: []string{"70", "77"}, Description: "Cardholder Name", DE55: false},
+	"5F24":    {MinLength: 3, MaxLength: 3, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Expiration Date", DE55: false},
+	"5F25":    {MinLength: 3, MaxLength: 3, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Effective Date", DE55: false},
+	"5F28":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Issuer Country Code", DE55: false},
+	"5F2A":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Currency Code", DE55: true},
+	"5F2D":    {MinLength: 2, MaxLength: 8, PadLeft: false, Format: "an", Source: "ICC", Templates: []string{"A5"}, Description: "Language Preference", DE55: false},
+	"5F30":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Service Code", DE55: false},
+	"5F34":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Primary Account Number (PAN) Sequence Number", DE55: true},
+	"5F36":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Currency Exponent", DE55: false},
+	"5F50":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "ans", Source: "ICC", Templates: []string{"BF0C"}, Description: "Issuer URL", DE55: false},
+	"5F53":    {MinLength: 0, MaxLength: 34, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"BF0C"}, Description: "International Bank Account Number (IBAN)", DE55: false},
+	"5F54":    {MinLength: 8, MaxLength: 11, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"BF0C"}, Description: "Bank Identifier Code (BIC)", DE55: false},
+	"5F55":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "a", Source: "ICC", Templates: []string{"BF0C"}, Description: "Issuer Country Code (alpha2 format)", DE55: false},
+	"5F56":    {MinLength: 3, MaxLength: 3, PadLeft: false, Format: "a", Source: "ICC", Templates: []string{"BF0C"}, Description: "Issuer Country Code (alpha3 format)", DE55: false},
+	"5F57":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "Terminal", Description: "Account Type", DE55: false},
+	"61":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Template", DE55: false},
+	"6F":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "var", Source: "ICC", Description: "File Control Information (FCI) Template", DE55: false},
+	"70":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "var", Source: "ICC", Description: "READ RECORD Response Message Template", DE55: false},
+	"71":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "Issuer", Description: "Issuer Script Template 1", DE55: true},
+	"72":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "Issuer", Description: "Issuer Script Template 2", DE55: true},
+	"73":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"61"}, Description: "Directory Discretionary Template", DE55: false},
+	"77":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "ICC", Description: "Response Message Template Format 2", DE55: false},
+	"80":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "ICC", Description: "Response Message Template Format 1", DE55: false},
+	"81":      {MinLength: 4, MaxLength: 4, PadLeft: false, Format: "b", Source: "Terminal", Description: "Amount, Authorized (Binary)", DE55: false},
+	"82":      {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "b", Source: "ICC", Templates: []string{"77", "80"}, Description: "Application Interchange Profile", DE55: true},
+	"83":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "Terminal", Description: "Command Template", DE55: false},
+	"84":      {MinLength: 5, MaxLength: 16, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"6F"}, Description: "Dedicated File (DF) Name", DE55: true},
+	"86":      {MinLength: 0, MaxLength: 261, PadLeft: false, Format: "b", Source: "Issuer", Templates: []string{"71", "72"}, Description: "Issuer Script Command", DE55: false},
+	"87":      {MinLength: 1, MaxLength: 1, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"61", "A5"}, Description: "Application Priority Indicator", DE55: false},
+	"88":      {MinLength: 1, MaxLength: 1, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"A5"}, Description: "Short File Identifier (SFI)", DE55: false},
+	"89":      {MinLength: 6, MaxLength: 6, PadLeft: false, Format: "ans", Source: "Issuer", Description: "Authorization Code", DE55: false},
+	"8A":      {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "an", Source: "Issuer", Description: "Authorization Response Code", DE55: false},
+	"8C":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Card Risk Management Data Object List 1 (CDOL1)", DE55: false},
+	"8D":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Card Risk Management Data Object List 2 (CDOL2)", DE55: false},
+	"8E":      {MinLength: 10, MaxLength: 252, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Cardholder Verification Method (CVM) List", DE55: false},
+	"8F":      {MinLength: 1, MaxLength: 1, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Certification Authority Public Key Index (ICC)", DE55: false},
+	"90":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Issuer Public Key Certificate", DE55: false},
+	"91":      {MinLength: 8, MaxLength: 16, PadLeft: false, Format: "b", Source: "Issuer", Description: "Issuer Authentication Data", DE55: true},
+	"92":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Issuer Public Key Remainder", DE55: false},
+	"93":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Signed Static Application Data", DE55: false},
+	"94":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"77", "80"}, Description: "Application File Locator (AFL)", DE55: false},
+	"95":      {MinLength: 5, MaxLength: 5, PadLeft: false, Format: "b", Source: "Terminal", Description: "Terminal Verification Results", DE55: true},
+	"97":      {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Transaction Certificate Data Object List (TDOL)", DE55: false},
+	"98":      {MinLength: 20, MaxLength: 20, PadLeft: false, Format: "b", Source: "Terminal", Description: "Transaction Certificate (TC) Hash Value", DE55: false},
+	"99":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "Terminal", Description: "Transaction Personal Identification Number (PIN) Data", DE55: false},
+	"9A":      {MinLength: 3, MaxLength: 3, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Date", DE55: true},
+	"9B":      {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "Terminal", Description: "Transaction Status Information", DE55: false},
+	"9C":      {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Type", DE55: true},
+	"9D":      {MinLength: 5, MaxLength: 16, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"61"}, Description: "Directory Definition File (DDF) Name", DE55: false},
+	"9F01":    {MinLength: 6, MaxLength: 6, PadLeft: true, Format: "n", Source: "Terminal", Description: "Acquirer Identifier", DE55: false},
+	"9F02":    {MinLength: 6, MaxLength: 6, PadLeft: true, Format: "n", Source: "Terminal", Description: "Amount, Authorized (Numeric)", DE55: true},
+	"9F03":    {MinLength: 6, MaxLength: 6, PadLeft: true, Format: "n", Source: "Terminal", Description: "Amount, Other (Numeric)", DE55: true},
+	"9F04":    {MinLength: 4, MaxLength: 4, PadLeft: false, Format: "b", Source: "Terminal", Description: "Amount, Other (Binary)", DE55: false},
+	"9F05":    {MinLength: 1, MaxLength: 32, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Discretionary Data", DE55: false},
+	"9F06":    {MinLength: 5, MaxLength: 16, PadLeft: false, Format: "b", Source: "Terminal", Description: "Application Identifier (AID) - terminal", DE55: false},
+	"9F07":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Usage Control", DE55: false},
+	"9F08":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Version Number (ICC)", DE55: false},
+	"9F09":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "Terminal", Description: "Application Version Number (Terminal)", DE55: true},
+	"9F0A":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"BF0C"}, Description: "Application Selection Registered Proprietary Data", DE55: false},
+	"9F0B":    {MinLength: 27, MaxLength: 45, PadLeft: false, Format: "ans", Source: "ICC", Templates: []string{"70", "77"}, Description: "Cardholder Name Extended", DE55: false},
+	"9F0C":    {MinLength: 3, MaxLength: 4, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"BF0C"}, Description: "Issuer Identification Number Extended (IINE)", DE55: false},
+	"9F0D":    {MinLength: 5, MaxLength: 5, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Issuer Action Code - Default", DE55: false},
+	"9F0E":    {MinLength: 5, MaxLength: 5, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Issuer Action Code - Denial", DE55: false},
+	"9F0F":    {MinLength: 5, MaxLength: 5, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Issuer Action Code - Online", DE55: false},
+	"9F10":    {MinLength: 0, MaxLength: 32, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"77", "80"}, Description: "Issuer Application Data", DE55: true},
+	"9F11":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"A5"}, Description: "Issuer Code Table Index", DE55: false},
+	"9F12":    {MinLength: 1, MaxLength: 16, PadLeft: false, Format: "ans", Source: "ICC", Templates: []string{"61", "A5"}, Description: "Application Preferred Name", DE55: false},
+	"9F13":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "ICC", Description: "Last Online Application Transaction Counter (ATC) Register", DE55: false},
+	"9F14":    {MinLength: 1, MaxLength: 1, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Lower Consecutive Offline Limit", DE55: false},
+	"9F15":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "n", Source: "Terminal", Description: "Merchant Category Code", DE55: false},
+	"9F16":    {MinLength: 15, MaxLength: 15, PadLeft: false, Format: "ans", Source: "Terminal", Description: "Merchant Identifier", DE55: false},
+	"9F17":    {MinLength: 1, MaxLength: 1, PadLeft: false, Format: "b", Source: "ICC", Description: "Personal Identification Number (PIN) Try Counter", DE55: false},
+	"9F18":    {MinLength: 4, MaxLength: 4, PadLeft: false, Format: "b", Source: "Issuer", Templates: []string{"71", "72"}, Description: "Issuer Script Identifier", DE55: false},
+	"9F1A":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "n", Source: "Terminal", Description: "Terminal Country Code", DE55: true},
+	"9F1B":    {MinLength: 4, MaxLength: 4, PadLeft: false, Format: "b", Source: "Terminal", Description: "Terminal Floor Limit", DE55: false},
+	"9F1C":    {MinLength: 8, MaxLength: 8, PadLeft: false, Format: "an", Source: "Terminal", Description: "Terminal Identification", DE55: false},
+	"9F1D":    {MinLength: 1, MaxLength: 8, PadLeft: false, Format: "b", Source: "Terminal", Description: "Terminal Risk Management Data", DE55: false},
+	"9F1E":    {MinLength: 8, MaxLength: 8, PadLeft: false, Format: "an", Source: "Terminal", Description: "Interface Device (IFD) Serial Number", DE55: true},
+	"9F1F":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "ans", Source: "ICC", Templates: []string{"70", "77"}, Description: "Track 1 Discretionary Data", DE55: false},
+	"9F20":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "cn", Source: "ICC", Templates: []string{"70", "77"}, Description: "Track 2 Discretionary Data", DE55: false},
+	"9F21":    {MinLength: 3, MaxLength: 3, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Time", DE55: false},
+	"9F22":    {MinLength: 1, MaxLength: 1, PadLeft: false, Format: "b", Source: "Terminal", Description: "Certification Authority Public Key Index (Terminal)", DE55: false},
+	"9F23":    {MinLength: 1, MaxLength: 1, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Upper Consecutive Offline Limit", DE55: false},
+	"9F26":    {MinLength: 8, MaxLength: 8, PadLeft: true, Format: "b", Source: "ICC", Templates: []string{"77", "80"}, Description: "Application Cryptogram", DE55: true},
+	"9F27":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "b", Source: "ICC", Templates: []string{"77", "80"}, Description: "Cryptogram Information Data", DE55: true},
+	"9F2D":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "ICC PIN Encipherment Public Key Certificate", DE55: false},
+	"9F2E":    {MinLength: 1, MaxLength: 3, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "ICC PIN Encipherment Public Key Exponent", DE55: false},
+	"9F2F":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "ICC PIN Encipherment Public Key Remainder", DE55: false},
+	"9F32":    {MinLength: 1, MaxLength: 3, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Issuer Public Key Exponent", DE55: false},
+	"9F33":    {MinLength: 3, MaxLength: 3, PadLeft: false, Format: "b", Source: "Terminal", Description: "Terminal Capabilities", DE55: true},
+	"9F34":    {MinLength: 3, MaxLength: 3, PadLeft: false, Format: "b", Source: "Terminal", Description: "Cardholder Verification Method (CVM) Results", DE55: true},
+	"9F35":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "Terminal", Description: "Terminal Type", DE55: true},
+	"9F36":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "b", Source: "ICC", Templates: []string{"77", "80"}, Description: "Application Transaction Counter (ATC)", DE55: true},
+	"9F37":    {MinLength: 4, MaxLength: 4, PadLeft: true, Format: "b", Source: "Terminal", Description: "Unpredictable Number", DE55: true},
+	"9F38":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"A5"}, Description: "Processing Options Data Object List (PDOL)", DE55: false},
+	"9F39":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "Terminal", Description: "Point-of-Service (POS) Entry Mode", DE55: false},
+	"9F3A":    {MinLength: 4, MaxLength: 4, PadLeft: false, Format: "b", Source: "Terminal", Description: "Amount, Reference Currency", DE55: false},
+	"9F3B":    {MinLength: 2, MaxLength: 8, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Reference Currency", DE55: false},
+	"9F3C":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Reference Currency Code", DE55: false},
+	"9F3D":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Reference Currency Exponent", DE55: false},
+	"9F40":    {MinLength: 5, MaxLength: 5, PadLeft: false, Format: "b", Source: "Terminal", Description: "Additional Terminal Capabilities", DE55: false},
+	"9F41":    {MinLength: 2, MaxLength: 4, PadLeft: true, Format: "n", Source: "Terminal", Description: "Transaction Sequence Counter", DE55: true},
+	"9F42":    {MinLength: 2, MaxLength: 2, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Currency Code", DE55: false},
+	"9F43":    {MinLength: 1, MaxLength: 4, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Reference Currency Exponent", DE55: false},
+	"9F44":    {MinLength: 1, MaxLength: 1, PadLeft: true, Format: "n", Source: "ICC", Templates: []string{"70", "77"}, Description: "Application Currency Exponent", DE55: false},
+	"9F45":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "ICC", Description: "Data Authentication Code", DE55: false},
+	"9F46":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "ICC Public Key Certificate", DE55: false},
+	"9F47":    {MinLength: 1, MaxLength: 3, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "ICC Public Key Exponent", DE55: false},
+	"9F48":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "ICC Public Key Remainder", DE55: false},
+	"9F49":    {MinLength: 0, MaxLength: 252, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"70", "77"}, Description: "Dynamic Data Authentication Data Object List (DDOL)", DE55: false},
+	"9F4A":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"70", "77"}, Description: "Static Data Authentication Tag List", DE55: false},
+	"9F4B":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"77", "80"}, Description: "Signed Dynamic Application Data", DE55: false},
+	"9F4C":    {MinLength: 2, MaxLength: 8, PadLeft: false, Format: "b", Source: "ICC", Description: "ICC Dynamic Number", DE55: false},
+	"9F4D":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"BF0C", "73"}, Description: "Log Entry", DE55: false},
+	"9F4E":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "ans", Source: "Terminal", Description: "Merchant Name and Location", DE55: false},
+	"9F4F":    {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Source: "ICC", Description: "Log Format", DE55: false},
+	"9F6C":    {MinLength: 2, MaxLength: 2, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"77"}, Description: "Card Transaction Qualifiers (CTQ)", DE55: false},
+	"9F6E":    {MinLength: 4, MaxLength: 4, PadLeft: false, Format: "b", Source: "ICC", Templates: []string{"77"}, Description: "Form Factor Indicator (FFI)", DE55: false},
+	"A5":      {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"6F"}, Description: "File Control Information (FCI) Proprietary Template", DE55: false},
+	"BF0C":    {MinLength: 0, MaxLength: 222, PadLeft: false, Format: "var", Source: "ICC", Templates: []string{"A5"}, Description: "File Control Information (FCI) Issuer Discretionary Data", DE55: false},
+	"DF8115":  {MinLength: 6, MaxLength: 6, PadLeft: false, Format: "b", Source: "Terminal", Description: "Error Indication", DE55: false},
+	"DF8116":  {MinLength: 22, MaxLength: 22, PadLeft: false, Format: "b", Source: "Terminal", Description: "User Interface Request Data", DE55: false},
+	"DF8129":  {MinLength: 8, MaxLength: 8, PadLeft: false, Format: "b", Source: "Terminal", Description: "Outcome Parameter Set", DE55: false},
+	"DF812A":  {MinLength: 0, MaxLength: 56, PadLeft: false, Format: "ans", Source: "ICC", Description: "DD Card (Track1)", DE55: false},
+	"DF812B":  {MinLength: 0, MaxLength: 8, PadLeft: false, Format: "b", Source: "ICC", Description: "DD Card (Track2)", DE55: false},
+	"FF8105":  {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "Terminal", Description: "Data Record", DE55: false},
+	"FF8106":  {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "var", Source: "Terminal", Description: "Discretionary Data", DE55: false},
+	"DEFAULT": {MinLength: 0, MaxLength: 0, PadLeft: false, Format: "b", Description: "Default Tag Format"},
 }
 
-// EMVTagMap provides a mapping from EMV tag to struct field
+// EMVTagMap provides a mapping from EMV tag to struct field.
+//
+// Deprecated: Parse, Marshal and Unmarshal no longer use it. It is built from
+// the same field metadata they use and kept for compatibility.
 type EMVTagMap map[string]fieldInfo
 
 type fieldInfo struct {
@@ -86,215 +300,152 @@ type fieldInfo struct {
 	Field reflect.StructField
 }
 
-// BuildEMVTagMap creates a mapping from EMV tags to struct fields
+// BuildEMVTagMap creates a mapping from EMV tags to the exported fields of
+// structType that carry an emv struct tag.
+//
+// Deprecated: Use Unmarshal, Marshal or EMVData.GetEMVPropertyByTag, which
+// look fields up directly.
 func BuildEMVTagMap(structType reflect.Type) EMVTagMap {
-	tagMap := make(EMVTagMap)
-
-	for i := range structType.NumField() {
-		field := structType.Field(i)
-
-		// Get the emv tag value from the struct tag
-		tagValue := field.Tag.Get("emv")
-		if tagValue != "" {
-			// Store field info in the map with the EMV tag as key
-			tagMap[tagValue] = fieldInfo{
-				Index: i,
-				Field: field,
-			}
-		}
+	fields := cachedFields(structType)
+	tagMap := make(EMVTagMap, len(fields.list))
+	for _, f := range fields.list {
+		tagMap[f.tag] = fieldInfo{Index: f.index, Field: structType.Field(f.index)}
 	}
-
 	return tagMap
 }
 
-// EMVParser handles parsing and mapping of EMV data
+// EMVParser handles parsing and mapping of EMV data. An EMVParser holds no
+// per-transaction state and is safe for concurrent use by multiple goroutines.
 type EMVParser struct {
-	tagMap EMVTagMap
-	data   *EMVData
-}
-
-// NewEMVParser creates a new EMV parser for the given struct type
-func NewEMVParser() *EMVParser {
-	// Build tag map from the EMVData struct
-	tagMap := BuildEMVTagMap(reflect.TypeOf(EMVData{}))
-
-	return &EMVParser{
-		tagMap: tagMap,
-		data:   &EMVData{},
-	}
-}
-
-// Parse EMV data using the parser
-func (parser *EMVParser) Parse(data []byte) (*EMVData, error) {
-	tagValues := make(map[string][]byte)
-
-	// Start parsing at position 0
-	pos := 0
-	for pos < len(data) {
-		// Ensure we have at least 1 byte for the tag
-		if pos >= len(data) {
-			break
-		}
-
-		// Determine tag length (1 or 2 bytes)
-		tagLen := 1
-		if (data[pos] & 0x1F) == 0x1F {
-			tagLen = 2
-			// Ensure we have enough bytes for a 2-byte tag
-			if pos+1 >= len(data) {
-				return nil, fmt.Errorf("unexpected end of data when reading tag")
-			}
-		}
-
-		// Extract the tag
-		tag := data[pos : pos+tagLen]
-		pos += tagLen
-
-		// Ensure we have at least 1 byte for the length
-		if pos >= len(data) {
-			return nil, fmt.Errorf("unexpected end of data when reading length")
-		}
+	// fields is the cached, read-only field metadata of EMVData
+	fields *structFields
 
-		// Determine the length of the value
-		lenByte := data[pos]
-		pos++
+	// logger receives diagnostics; nil disables them
+	logger *slog.Logger
 
-		valueLen := 0
-		if (lenByte & 0x80) != 0 {
-			// Length is in the next N bytes where N is (lenByte & 0x7F)
-			lenBytes := int(lenByte & 0x7F)
-			if pos+lenBytes > len(data) {
-				return nil, fmt.Errorf("unexpected end of data when reading extended length")
-			}
-
-			// Calculate length from multiple bytes
-			for i := 0; i < lenBytes; i++ {
-				valueLen = (valueLen << 8) | int(data[pos])
-				pos++
-			}
-		} else {
-			// Length is in this byte
-			valueLen = int(lenByte)
-		}
+	// order decides the order of the tags emitted by Marshal
+	order TagOrder
 
-		// Ensure we have enough bytes for the value
-		if pos+valueLen > len(data) {
-			return nil, fmt.Errorf("unexpected end of data when reading value")
-		}
+	// parseOpts controls how Parse decodes data
+	parseOpts ParseOptions
 
-		// Extract the value
-		value := data[pos : pos+valueLen]
-		pos += valueLen
+	// registry holds the tag formats used to decode and encode values
+	registry *TagRegistry
 
-		// Check if the tag is a constructed tag (6th bit of the first byte is set)
-		if (tag[0] & 0x20) != 0 {
-			// This is a constructed tag, recursively parse its value
-			subTags, err := parser.Parse(value)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing constructed tag %X: %v", tag, err)
-			}
+	// validate makes Parse check values against their format
+	validate bool
+}
 
-			// Add sub-tags to the main map
-			for subTag, subValue := range subTags.toMap() {
-				tagValues[subTag] = subValue
-			}
-		} else {
-			// Store the tag and value in the map
-			tagHex := fmt.Sprintf("%X", tag) // Convert tag to uppercase hex string
-			tagValues[tagHex] = value
-		}
+// NewEMVParser creates a new EMV parser for the EMVData struct
+func NewEMVParser(opts ...ParserOption) *EMVParser {
+	parser := &EMVParser{
+		fields:   cachedFields(reflect.TypeOf(EMVData{})),
+		registry: DefaultTagRegistry,
 	}
 
-	// Populate the internal EMVData instance
-	v := reflect.ValueOf(parser.data).Elem()
-	for tag, value := range tagValues {
-		fieldInfo, ok := parser.tagMap[tag]
-		if !ok {
-			// Log unknown tag
-			log.Printf("Warning: Tag %s found in data but not defined in EMVData\n", tag)
-			continue // Skip unknown tags
-		}
-
-		field := v.Field(fieldInfo.Index)
-		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 {
-			field.SetBytes(value)
-		} else if field.Kind() == reflect.String {
-			field.SetString(string(value))
-		}
+	for _, opt := range opts {
+		opt(parser)
+	}
+	if parser.registry == nil {
+		parser.registry = DefaultTagRegistry
 	}
 
-	return parser.data, nil
+	return parser
 }
 
-// Format a value according to the EMV tag format
-func formatValueForTag(value []byte, tag string) []byte {
-	// Get format for this tag
-	format, ok := EMVTagFormats[tag]
-	if !ok {
-		format = EMVTagFormats["DEFAULT"]
+// Parse EMV data using the parser. Each call returns a new EMVData.
+func (parser *EMVParser) Parse(data []byte) (*EMVData, error) {
+	d := newTreeDecoder(parser.parseOpts)
+	d.registry = parser.registry
+	d.validate = parser.validate
+	d.keepOrder = true
+	if parser.logger != nil {
+		d.unknown = func(node *TLV) {
+			// Unknown tags are kept in Extra, so this is only a diagnostic
+			parser.logger.Debug("tag found in data but not defined in EMVData", "tag", node.Tag, "offset", node.Offset)
+		}
 	}
 
-	// If value is already longer than minimum length, return as is
-	if len(value) >= format.MinLength {
-		return value
+	// Populate a fresh EMVData instance straight from the data, without
+	// building a tree first
+	parsed := &EMVData{}
+	if parser.registry != DefaultTagRegistry {
+		parsed.registry = parser.registry
 	}
-
-	// Apply padding
-	paddedValue := make([]byte, format.MinLength)
-
-	if format.PadLeft {
-		// Pad on the left with zeros
-		copy(paddedValue[format.MinLength-len(value):], value)
-	} else {
-		// Pad on the right with zeros
-		copy(paddedValue, value)
+	if err := d.decodeStruct(data, 0, 1, reflect.ValueOf(parsed).Elem(), nil); err != nil {
+		return nil, err
 	}
+	parsed.Warnings = d.warnings
+	parsed.Violations = d.violations
+	parsed.order = d.order
+	parsed.TransactionStatusInfo = parsed.FormFactorIndicator
+	parsed.IntegredCircuitLevelResults = parsed.CryptogramInformationData
 
-	return paddedValue
+	return parsed, nil
 }
 
-// Encode a single TLV
-func encodeTLV(tag string, value []byte) []byte {
-	// Decode tag from hex string
-	tagBytes, _ := hex.DecodeString(tag)
-
-	// Create TLV
-	result := tagBytes
-
-	// Encode length
-	if len(value) < 128 {
-		// Short form
-		result = append(result, byte(len(value)))
-	} else {
-		// Long form
-		// Determine how many bytes needed for length
-		lenBytes := 0
-		temp := len(value)
-		for temp > 0 {
-			lenBytes++
-			temp >>= 8
+// formatValueForTag pads a value shorter than MinLength the way EMV Book 3
+// section 4.3 pads its format: n with leading zeros, cn with trailing F
+// nibbles and a, an and ans with trailing spaces. b values are padded with
+// zeros on the side PadLeft selects. The result is then checked like
+// validateValue does, so an invalid value is reported instead of emitted.
+func formatValueForTag(value []byte, format EMVTagFormat) ([]byte, error) {
+	if len(value) < format.MinLength {
+		padded := make([]byte, format.MinLength)
+		fill := padded[len(value):]
+		switch format.Format {
+		case "n":
+			fill = padded[:format.MinLength-len(value)]
+			copy(padded[len(fill):], value)
+		case "cn":
+			copy(padded, value)
+			for i := range fill {
+				fill[i] = 0xFF
+			}
+		case "a", "an", "ans":
+			copy(padded, value)
+			for i := range fill {
+				fill[i] = ' '
+			}
+		default:
+			if format.PadLeft {
+				copy(padded[format.MinLength-len(value):], value)
+			} else {
+				copy(padded, value)
+			}
 		}
+		value = padded
+	}
 
-		// Add length byte with MSB set and number of length bytes
-		result = append(result, byte(0x80|lenBytes))
-
-		// Add length bytes
-		for i := lenBytes - 1; i >= 0; i-- {
-			result = append(result, byte((len(value)>>(i*8))&0xFF))
-		}
+	if err := validateValue(value, format); err != nil {
+		return nil, err
 	}
+	return value, nil
+}
 
-	// Add value
-	result = append(result, value...)
+// appendTLV appends the encoding of a data object with a hex tag such as
+// "9F26" to dst
+func appendTLV(dst []byte, tag string, value []byte) []byte {
+	return tlv.Append(dst, tagValue(tag), value)
+}
 
-	return result
+// tagValue converts a hex tag such as "9F26" to the uint32 form used by
+// package tlv
+func tagValue(tag string) uint32 {
+	var n uint32
+	for i := 0; i < len(tag); i++ {
+		n = n<<4 | uint32(hexNibble(tag[i]))
+	}
+	return n
 }
 
 // Check if a reflection value is zero
 func isZeroValue(v reflect.Value) bool {
 	switch v.Kind() {
-	case reflect.Slice, reflect.Map, reflect.Interface, reflect.Ptr:
+	case reflect.Slice, reflect.Map:
 		return v.IsNil() || v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
 	case reflect.String:
 		return v.Len() == 0
 	default:
@@ -321,66 +472,15 @@ func isZeroValue(v reflect.Value) bool {
 //     the map with the successfully parsed TLVs up to that point.
 func extractTLVs(data []byte) map[string][]byte {
 	result := make(map[string][]byte)
-	pos := 0
-
-	for pos < len(data) {
-		// Check if we have enough data
-		if pos >= len(data) {
-			break
-		}
-
-		// Determine tag length
-		tagLen := 1
-		if (data[pos] & 0x1F) == 0x1F {
-			tagLen = 2
-			if pos+1 >= len(data) {
-				break
-			}
-		}
-
-		// Extract tag
-		tag := fmt.Sprintf("%X", data[pos:pos+tagLen])
-		pos += tagLen
-
-		// Get length
-		if pos >= len(data) {
-			break
-		}
-
-		lenByte := data[pos]
-		pos++
-
-		var valueLen int
-		if (lenByte & 0x80) != 0 {
-			lenBytes := int(lenByte & 0x7F)
-			if pos+lenBytes > len(data) {
-				break
-			}
-
-			valueLen = 0
-			for i := 0; i < lenBytes; i++ {
-				valueLen = (valueLen << 8) | int(data[pos])
-				pos++
-			}
-		} else {
-			valueLen = int(lenByte)
-		}
-
-		// Extract value
-		if pos+valueLen > len(data) {
-			break
-		}
-
-		value := data[pos : pos+valueLen]
-		pos += valueLen
 
+	it := tlv.NewIterator(data)
+	for it.Next() {
 		// Store in result
-		result[tag] = value
+		result[tlv.FormatTag(it.Tag())] = it.Value()
 
 		// If this is a constructed tag, also extract its inner TLVs
-		if (data[pos-valueLen-tagLen-1] & 0x20) != 0 {
-			innerTLVs := extractTLVs(value)
-			for innerTag, innerValue := range innerTLVs {
+		if tlv.Constructed(it.Tag()) {
+			for innerTag, innerValue := range extractTLVs(it.Value()) {
 				result[innerTag] = innerValue
 			}
 		}
@@ -389,96 +489,88 @@ func extractTLVs(data []byte) map[string][]byte {
 	return result
 }
 
-// Helper method to convert EMVData to a map for nested tag handling
-func (data *EMVData) toMap() map[string][]byte {
-	result := make(map[string][]byte)
-	v := reflect.ValueOf(data).Elem()
-	t := v.Type()
-
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
-		tag := t.Field(i).Tag.Get("emv")
-
-		if isZeroValue(field) {
-			continue
-		}
-
-		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 {
-			result[tag] = field.Bytes()
-		} else if field.Kind() == reflect.String {
-			result[tag] = []byte(field.String())
-		}
-	}
-
-	return result
+// Marshal EMV data using the parser. Only tags marked as DE55 are emitted,
+// together with the tags in Extra that the dictionary does not exclude from
+// DE55. Tags are emitted in the parser's TagOrder, ParsedOrder by default.
+// Field values are padded to their format, and a value that cannot be made
+// valid is reported as an *EncodeError.
+func (parser *EMVParser) Marshal(data *EMVData) ([]byte, error) {
+	return parser.AppendMarshal([]byte{}, data)
 }
 
-// Marshal EMV data using the parser
-func (parser *EMVParser) Marshal(data *EMVData) ([]byte, error) {
-	result := []byte{}
+// AppendMarshal is like Marshal but appends the DE55 data to dst, so callers
+// can reuse a buffer
+func (parser *EMVParser) AppendMarshal(dst []byte, data *EMVData) ([]byte, error) {
+	if len(data.CryptogramInformationData) == 0 && len(data.IntegredCircuitLevelResults) > 0 {
+		// Callers of the deprecated field still get 9F27
+		compat := *data
+		compat.CryptogramInformationData = data.IntegredCircuitLevelResults
+		data = &compat
+	}
 	v := reflect.ValueOf(data).Elem()
 
-	// Map to temporarily store tag-value pairs
-	tlvMap := make(map[string][]byte)
-
 	// Collect all non-empty fields
-	for tag, fieldInfo := range parser.tagMap {
+	var nodes TLVList
+	for _, f := range parser.fields.list {
+		tag := f.tag
+
 		// Check if the tag is marked as DE55
-		format, ok := EMVTagFormats[tag]
+		format, ok := parser.registry.lookup(tag)
 		if !ok || !format.DE55 {
 			continue // Skip tags not marked as DE55
 		}
 
-		field := v.Field(fieldInfo.Index)
+		field := v.Field(f.index)
 		if isZeroValue(field) {
 			continue
 		}
 
-		var value []byte
-		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 {
-			value = field.Bytes()
-		} else if field.Kind() == reflect.String {
-			value = []byte(field.String())
+		value, err := encodeValue(field, format)
+		if err != nil {
+			return nil, &EncodeError{Field: f.name, Tag: tag, Err: err}
 		}
 
 		// Apply formatting
-		value = formatValueForTag(value, tag)
+		value, err = formatValueForTag(value, format)
+		if err != nil {
+			return nil, &EncodeError{Field: f.name, Tag: tag, Err: err}
+		}
 
-		// Store in map
-		tlvMap[tag] = value
+		nodes = append(nodes, &TLV{Tag: tag, Length: len(value), Value: value})
 	}
 
-	// Encode all tags in a flat structure
-	for tag, value := range tlvMap {
-		tlv := encodeTLV(tag, value)
-		result = append(result, tlv...)
+	// Add unknown tags, except those the dictionary excludes from DE55
+	for _, node := range data.Extra {
+		if format, ok := parser.registry.lookup(node.Tag); ok && !format.DE55 {
+			continue
+		}
+		nodes = append(nodes, node)
 	}
 
-	return result, nil
+	// Encode all tags in a flat structure
+	parser.order.sortTLVs(nodes, data.order)
+	return nodes.appendTo(dst), nil
 }
 
-// GetEMVPropertyByTag retrieves the value of an EMV property from the internal EMVData instance based on the provided EMV tag.
-func (parser *EMVParser) GetEMVPropertyByTag(tag string) ([]byte, error) {
-	// Use reflection to access the fields of the EMVData struct
-	v := reflect.ValueOf(parser.data).Elem()
-	t := v.Type()
-
-	// Iterate through the fields of the struct
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
-		fieldTag := t.Field(i).Tag.Get("emv")
-
-		// Check if the field's EMV tag matches the input tag
-		if fieldTag == tag {
-			// Return the value as a byte slice
-			if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 {
-				return field.Bytes(), nil
-			} else if field.Kind() == reflect.String {
-				return []byte(field.String()), nil
-			}
+// GetEMVPropertyByTag retrieves the value of an EMV property based on the provided EMV tag.
+func (data *EMVData) GetEMVPropertyByTag(tag string) ([]byte, error) {
+	fields := cachedFields(reflect.TypeOf(*data))
+	i, ok := fields.byTag[tagValue(tag)]
+	if !ok || fields.list[i].tag != tag {
+		// Fall back to the data objects without a field, including those
+		// inside the templates kept in Extra
+		if node := data.Extra.find(tag); node != nil {
+			return node.Value, nil
 		}
+
+		// Return an error if the tag is not found
+		return nil, fmt.Errorf("tag %s not found in EMVData", tag)
 	}
 
-	// Return an error if the tag is not found
-	return nil, fmt.Errorf("tag %s not found in EMVData", tag)
+	// Return the value as a byte slice
+	registry := data.registry
+	if registry == nil {
+		registry = DefaultTagRegistry
+	}
+	return encodeValue(reflect.ValueOf(data).Elem().Field(fields.list[i].index), registry.format(tag))
 }
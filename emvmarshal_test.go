@@ -1,10 +1,17 @@
 package emvparser
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/wadearnold/kernel/tlv"
 )
 
 // Helper function to test parsing and marshaling of EMV data
@@ -52,6 +59,15 @@ func testEMVData(t *testing.T, rawData string) {
 	fmt.Println("\n=== Comparison ===")
 	compareEMVData(emvData, reEncodedData)
 
+	// The TLV tree re-encodes the input byte for byte
+	nodes, err := DecodeTree(emvData)
+	if err != nil {
+		t.Fatalf("Error decoding TLV tree: %v", err)
+	}
+	if raw := nodes.MarshalRaw(); !bytes.Equal(raw, emvData) {
+		t.Errorf("Expected MarshalRaw to reproduce %X, got: %X", emvData, raw)
+	}
+
 	// Test a round trip with both format-aware parsing and encoding
 	fmt.Println("\n=== Round Trip Test ===")
 	// Parse the re-encoded data using the parser
@@ -83,7 +99,7 @@ func printEMVDataWithDescriptions(data *EMVData) {
 		fieldName := t.Field(i).Name
 		tag := t.Field(i).Tag.Get("emv")
 
-		if isZeroValue(field) {
+		if isZeroValue(field) || !t.Field(i).IsExported() {
 			continue
 		}
 
@@ -93,6 +109,13 @@ func printEMVDataWithDescriptions(data *EMVData) {
 			description = format.Description
 		}
 
+		if extra, ok := field.Interface().(TLVList); ok {
+			for _, node := range extra {
+				fmt.Printf("Extra: Tag %s\n  Value (hex): %X\n", node.Tag, node.Value)
+			}
+			continue
+		}
+
 		fmt.Printf("Field: %s (Tag: %s - %s)\n", fieldName, tag, description)
 		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 {
 			fmt.Printf("  Value (hex): %X\n", field.Bytes())
@@ -293,11 +316,8 @@ func TestMarshalExcludesNonDE55Tags(t *testing.T) {
 	}
 }
 func TestGetEMVPropertyByTag(t *testing.T) {
-	// Create an EMVParser instance
-	parser := NewEMVParser()
-
-	// Populate the EMVData instance with some test data
-	parser.data = &EMVData{
+	// Create an EMVData instance with some test data
+	data := &EMVData{
 		IssuerAppData:                 []byte{0x12, 0x34, 0x56}, // Tag 9F10
 		ApplicationTransactionCounter: []byte{0x00, 0x01},       // Tag 9F36
 		ApplicationLabel:              "VISA",                   // Tag 50
@@ -305,7 +325,7 @@ func TestGetEMVPropertyByTag(t *testing.T) {
 
 	// Test case 1: Retrieve an existing tag (9F10 - Issuer Application Data)
 	tag := "9F10"
-	value, err := parser.GetEMVPropertyByTag(tag)
+	value, err := data.GetEMVPropertyByTag(tag)
 	if err != nil {
 		t.Fatalf("Error retrieving tag %s: %v", tag, err)
 	}
@@ -318,7 +338,7 @@ func TestGetEMVPropertyByTag(t *testing.T) {
 
 	// Test case 2: Retrieve another existing tag (50 - Application Label)
 	tag = "50"
-	value, err = parser.GetEMVPropertyByTag(tag)
+	value, err = data.GetEMVPropertyByTag(tag)
 	if err != nil {
 		t.Fatalf("Error retrieving tag %s: %v", tag, err)
 	}
@@ -329,3 +349,563 @@ func TestGetEMVPropertyByTag(t *testing.T) {
 		fmt.Printf("Tag %s retrieved successfully: %s\n", tag, string(value))
 	}
 }
+
+func TestParseThreeByteTags(t *testing.T) {
+	// Outcome Parameter Set (DF8129) and Issuer Application Data (9F10)
+	// wrapped in a Data Record (FF8105)
+	rawData := "FF810516DF8129081020F000000000009F1007060112039000009F360200699F2701809000"
+	data, err := hex.DecodeString(rawData)
+	if err != nil {
+		t.Fatalf("Error decoding hex: %v", err)
+	}
+	data = data[:len(data)-2] // Remove status word
+
+	parser := NewEMVParser()
+	parsedData, err := parser.Parse(data)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+
+	expectedIAD := []byte{0x06, 0x01, 0x12, 0x03, 0x90, 0x00, 0x00}
+	if !bytesEqual(parsedData.IssuerAppData, expectedIAD) {
+		t.Errorf("Expected IAD %X, got: %X", expectedIAD, parsedData.IssuerAppData)
+	}
+
+	tlvs := extractTLVs(data)
+	for _, tag := range []string{"FF8105", "DF8129", "9F10", "9F36", "9F27"} {
+		if _, exists := tlvs[tag]; !exists {
+			t.Errorf("Tag %s should have been extracted", tag)
+		}
+	}
+
+	// Three-byte tags must survive encoding
+	encoded := tlv.Append(nil, 0xDF8129, tlvs["DF8129"])
+	if fmt.Sprintf("%X", encoded) != "DF8129081020F00000000000" {
+		t.Errorf("Unexpected encoding of DF8129: %X", encoded)
+	}
+}
+
+func TestParseReturnsFreshData(t *testing.T) {
+	gpo, _ := hex.DecodeString("77598202200057134147202500716749D26072011010041301051F5F200F43415244484F4C4445522F564953415F3401019F100706021203A000009F2608D0C669EEB70C58DD9F2701809F360200699F6C0200009F6E0420700000")
+	ppse, _ := hex.DecodeString("6F30840E325041592E5359532E4444463031A51EBF0C1B61194F07A0000000031010500B5649534120435245444954870101")
+
+	parser := NewEMVParser()
+
+	first, err := parser.Parse(gpo)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	second, err := parser.Parse(ppse)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+
+	if first == second {
+		t.Fatalf("Parse should return a new EMVData for each call")
+	}
+	if len(second.IssuerAppData) != 0 {
+		t.Errorf("Fields from a previous Parse call leaked into the next: %X", second.IssuerAppData)
+	}
+	if len(first.IssuerAppData) == 0 {
+		t.Errorf("A later Parse call should not modify an earlier result")
+	}
+}
+
+func TestParseConcurrent(t *testing.T) {
+	gpo, _ := hex.DecodeString("77598202200057134147202500716749D26072011010041301051F5F200F43415244484F4C4445522F564953415F3401019F100706021203A000009F2608D0C669EEB70C58DD9F2701809F360200699F6C0200009F6E0420700000")
+	ppse, _ := hex.DecodeString("6F30840E325041592E5359532E4444463031A51EBF0C1B61194F07A0000000031010500B5649534120435245444954870101")
+
+	parser := NewEMVParser()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			data, err := parser.Parse(gpo)
+			if err == nil && data.ApplicationLabel != "" {
+				err = fmt.Errorf("GPO result has application label %q", data.ApplicationLabel)
+			}
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			data, err := parser.Parse(ppse)
+			if err == nil && len(data.ApplicationCryptogram) != 0 {
+				err = fmt.Errorf("PPSE result has application cryptogram %X", data.ApplicationCryptogram)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseKeepsUnknownTags(t *testing.T) {
+	// Transaction Category Code (9F53), Customer Exclusive Data (9F7C) and
+	// Outcome Parameter Set (DF8129) have no EMVData field. DF8129 and the
+	// Application Label (50) are not sent in DE55.
+	data := mustDecodeHex(t, "9F2608D0C669EEB70C58DD9F5301529F7C0401020304DF8129081020F000000000009F360200695004564953419F1A020840")
+
+	parser := NewEMVParser()
+	parsedData, err := parser.Parse(data)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+
+	expectedTags := []string{"9F53", "9F7C", "DF8129"}
+	if len(parsedData.Extra) != len(expectedTags) {
+		t.Fatalf("Expected %d extra tags, got: %d", len(expectedTags), len(parsedData.Extra))
+	}
+	for i, tag := range expectedTags {
+		if parsedData.Extra[i].Tag != tag {
+			t.Errorf("Extra tag %d: expected %s, got: %s", i, tag, parsedData.Extra[i].Tag)
+		}
+	}
+
+	value, err := parsedData.GetEMVPropertyByTag("9F7C")
+	if err != nil || fmt.Sprintf("%X", value) != "01020304" {
+		t.Errorf("Expected 9F7C value 01020304, got: %X (%v)", value, err)
+	}
+
+	marshaledData, err := parser.Marshal(parsedData)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+
+	decodedTags := extractTLVs(marshaledData)
+	for _, tag := range []string{"9F53", "9F7C", "9F26", "9F36", "9F1A"} {
+		if _, exists := decodedTags[tag]; !exists {
+			t.Errorf("Tag %s should appear in the output", tag)
+		}
+	}
+	for _, tag := range []string{"50", "DF8129"} {
+		if _, exists := decodedTags[tag]; exists {
+			t.Errorf("Tag %s should not appear in the output", tag)
+		}
+	}
+}
+
+func TestParseKeepsUnknownTemplates(t *testing.T) {
+	// Issuer script templates 71 and 72 have no EMVData field; their
+	// children 9F18 and 86 are not DE55 tags on their own
+	data := mustDecodeHex(t, "9F2701809F360200697110"+"9F180400000001"+"860784240000040000"+
+		"7209"+"9F180400000002"+"8600")
+
+	parser := NewEMVParser()
+	parsedData, err := parser.Parse(data)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+
+	if len(parsedData.Extra) != 2 || parsedData.Extra[0].Tag != "71" || parsedData.Extra[1].Tag != "72" {
+		t.Fatalf("Expected the 71 and 72 templates in Extra, got: %d tags", len(parsedData.Extra))
+	}
+	if script := parsedData.Extra[0]; len(script.Children) != 2 || script.Children[1].Tag != "86" {
+		t.Errorf("Expected 71 to keep 9F18 and 86 as children, got: %d children", len(script.Children))
+	}
+	value, err := parsedData.GetEMVPropertyByTag("9F18")
+	if err != nil || fmt.Sprintf("%X", value) != "00000001" {
+		t.Errorf("Expected 9F18 value 00000001, got: %X (%v)", value, err)
+	}
+
+	marshaledData, err := parser.Marshal(parsedData)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if !bytesEqual(marshaledData, data) {
+		t.Errorf("Expected %X, got: %X", data, marshaledData)
+	}
+}
+
+func TestParseSkipsPadding(t *testing.T) {
+	data := mustDecodeHex(t, "9F2701800000")
+
+	parser := NewEMVParser()
+	parsedData, err := parser.Parse(data)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if len(parsedData.Extra) != 0 || len(parsedData.Warnings) != 0 {
+		t.Errorf("Expected the padding to be skipped silently, got: %d tags in Extra, %v", len(parsedData.Extra), parsedData.Warnings)
+	}
+
+	marshaledData, err := parser.Marshal(parsedData)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if got := fmt.Sprintf("%X", marshaledData); got != "9F270180" {
+		t.Errorf("Expected 9F270180, got: %s", got)
+	}
+}
+
+func TestParseDropsConsumedTemplates(t *testing.T) {
+	// E0 has no EMVData field, and its only child 9F26 has one
+	data := mustDecodeHex(t, "E00B9F2608D0C669EEB70C58DD")
+
+	parser := NewEMVParser()
+	parsedData, err := parser.Parse(data)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if len(parsedData.Extra) != 0 {
+		t.Errorf("Expected no tags in Extra, got: %d tags", len(parsedData.Extra))
+	}
+
+	marshaledData, err := parser.Marshal(parsedData)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if got := fmt.Sprintf("%X", marshaledData); got != "9F2608D0C669EEB70C58DD" {
+		t.Errorf("Expected 9F26 once, got: %s", got)
+	}
+}
+
+func TestParserLogger(t *testing.T) {
+	data := mustDecodeHex(t, "9F5301529F360200699F7C0401020304")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	parser := NewEMVParser(WithLogger(logger))
+	if _, err := parser.Parse(data); err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+
+	output := buf.String()
+	for _, expected := range []string{"tag=9F53 offset=0", "tag=9F7C offset=9"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected log output to contain %q, got: %s", expected, output)
+		}
+	}
+	if strings.Contains(output, "9F36") {
+		t.Errorf("Known tag 9F36 should not be logged")
+	}
+}
+
+// Helper returning the top-level tags of TLV data in order
+func tagSequence(t *testing.T, data []byte) string {
+	t.Helper()
+	nodes, err := DecodeTree(data)
+	if err != nil {
+		t.Fatalf("Error decoding TLV tree: %v", err)
+	}
+	tags := make([]string, len(nodes))
+	for i, node := range nodes {
+		tags[i] = node.Tag
+	}
+	return strings.Join(tags, ",")
+}
+
+func TestMarshalOrder(t *testing.T) {
+	// DE55 in an order that is neither ascending nor a scheme order
+	data := mustDecodeHex(t, "9F3602006995050000008000820220009F2608D0C669EEB70C58DD9F1A0208409F100706011203A000009F270180")
+
+	tests := []struct {
+		name     string
+		order    []ParserOption
+		expected string
+	}{
+		{"parsed", nil, "9F36,95,82,9F26,9F1A,9F10,9F27"},
+		{"ascending", []ParserOption{WithTagOrder(AscendingOrder)}, "82,95,9F10,9F1A,9F26,9F27,9F36"},
+		{"scheme", []ParserOption{WithTagOrder(SchemeOrder("9F26", "9F27", "9F10", "9F36", "95", "82", "9F1A"))}, "9F26,9F27,9F10,9F36,95,82,9F1A"},
+		{"custom", []ParserOption{WithTagOrder(SchemeOrder("9F1A", "82"))}, "9F1A,82,9F36,95,9F26,9F10,9F27"},
+	}
+
+	for _, tt := range tests {
+		parser := NewEMVParser(tt.order...)
+		parsedData, err := parser.Parse(data)
+		if err != nil {
+			t.Fatalf("%s: error parsing EMV data: %v", tt.name, err)
+		}
+
+		first, err := parser.Marshal(parsedData)
+		if err != nil {
+			t.Fatalf("%s: error marshaling EMV data: %v", tt.name, err)
+		}
+		if sequence := tagSequence(t, first); sequence != tt.expected {
+			t.Errorf("%s: expected tag order %s, got: %s", tt.name, tt.expected, sequence)
+		}
+
+		// Identical input must give byte-identical output
+		for i := 0; i < 20; i++ {
+			again, err := parser.Marshal(parsedData)
+			if err != nil {
+				t.Fatalf("%s: error marshaling EMV data: %v", tt.name, err)
+			}
+			if !bytesEqual(first, again) {
+				t.Fatalf("%s: Marshal output changed between calls: %X and %X", tt.name, first, again)
+			}
+		}
+	}
+}
+
+func TestMarshalOrderWithoutParse(t *testing.T) {
+	// Fields set by hand follow EMVData field order
+	data := &EMVData{
+		ApplicationTransactionCounter: []byte{0x00, 0x01},
+		IssuerAppData:                 []byte{0x12, 0x34, 0x56},
+		AIP:                           []byte{0x20, 0x00},
+	}
+
+	marshaledData, err := NewEMVParser().Marshal(data)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if sequence := tagSequence(t, marshaledData); sequence != "82,9F10,9F36" {
+		t.Errorf("Expected tag order 82,9F10,9F36, got: %s", sequence)
+	}
+}
+
+func TestEMVTagFormatsDictionary(t *testing.T) {
+	formats := map[string]bool{"a": true, "an": true, "ans": true, "b": true, "cn": true, "n": true, "var": true}
+	sources := map[string]bool{"ICC": true, "Terminal": true, "Issuer": true}
+
+	for tag, format := range EMVTagFormats {
+		if tag == "DEFAULT" {
+			continue
+		}
+		if _, err := hex.DecodeString(tag); err != nil {
+			t.Errorf("Tag %s is not a hex string", tag)
+		}
+		if format.Description == "" {
+			t.Errorf("Tag %s has no description", tag)
+		}
+		if !formats[format.Format] {
+			t.Errorf("Tag %s has unknown format %q", tag, format.Format)
+		}
+		if !sources[format.Source] {
+			t.Errorf("Tag %s has unknown source %q", tag, format.Source)
+		}
+		if format.MaxLength != 0 && format.MinLength > format.MaxLength {
+			t.Errorf("Tag %s has minimum length %d above maximum length %d", tag, format.MinLength, format.MaxLength)
+		}
+		for _, template := range format.Templates {
+			if _, ok := EMVTagFormats[template]; !ok {
+				t.Errorf("Tag %s lists template %s which is not in the dictionary", tag, template)
+			}
+		}
+	}
+}
+
+func TestMarshalAuthorizationDE55(t *testing.T) {
+	data := &EMVData{
+		ApplicationCryptogram:         mustDecodeHex(t, "D0C669EEB70C58DD"),
+		CryptogramInformationData:     []byte{0x80},
+		IssuerAppData:                 mustDecodeHex(t, "06011203A00000"),
+		UnpredictableNumber:           mustDecodeHex(t, "12345678"),
+		ApplicationTransactionCounter: []byte{0x00, 0x69},
+		TerminalVerificationResults:   mustDecodeHex(t, "0000008000"),
+		TransactionDate:               mustDecodeHex(t, "251016"),
+		TransactionType:               []byte{0x00},
+		AmountAuthorized:              mustDecodeHex(t, "000000001000"),
+		TransactionCurrencyCode:       mustDecodeHex(t, "0840"),
+		AIP:                           []byte{0x20, 0x00},
+		TerminalCountryCode:           mustDecodeHex(t, "0840"),
+		AmountOther:                   mustDecodeHex(t, "000000000000"),
+		CVMResults:                    mustDecodeHex(t, "1E0300"),
+		TerminalCapabilities:          mustDecodeHex(t, "E0F8C8"),
+		TerminalType:                  []byte{0x22},
+		IFDSerialNumber:               "12345678",
+		DedicatedFileName:             mustDecodeHex(t, "A0000000031010"),
+		TerminalApplicationVersion:    []byte{0x00, 0x96},
+		TransactionSequenceCounter:    mustDecodeHex(t, "00000001"),
+		PanSequenceNumber:             []byte{0x01},
+		ApplicationLabel:              "VISA",
+	}
+
+	expected := "9F26,9F27,9F10,9F37,9F36,95,9A,9C,9F02,5F2A,82,9F1A,9F03,9F34,9F35,9F1E,84,9F09,9F33,9F41,5F34"
+	marshaledData, err := NewEMVParser(WithTagOrder(SchemeOrder(strings.Split(expected, ",")...))).Marshal(data)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+
+	if sequence := tagSequence(t, marshaledData); sequence != expected {
+		t.Errorf("Expected DE55 tags %s, got: %s", expected, sequence)
+	}
+}
+
+func TestDeprecatedCryptogramInformationData(t *testing.T) {
+	parser := NewEMVParser()
+	parsedData, err := parser.Parse(mustDecodeHex(t, "9F270180"))
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if fmt.Sprintf("%X", parsedData.IntegredCircuitLevelResults) != "80" {
+		t.Errorf("Expected the deprecated field to hold 9F27, got: %X", parsedData.IntegredCircuitLevelResults)
+	}
+
+	// Setting only the deprecated field still emits 9F27
+	data := &EMVData{IntegredCircuitLevelResults: []byte{0x40}}
+	marshaledData, err := parser.Marshal(data)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if got := fmt.Sprintf("%X", marshaledData); got != "9F270140" {
+		t.Errorf("Expected 9F270140, got: %s", got)
+	}
+	if data.CryptogramInformationData != nil {
+		t.Errorf("Expected Marshal to leave the data unchanged")
+	}
+}
+
+// Helper splitting a camelCase JSON name into lowercase words. Runs of
+// capitals such as "ICC" form one word and digits stay with the word before.
+func camelWords(name string) []string {
+	var words []string
+	start := 0
+	for i := 1; i < len(name); i++ {
+		prevUpper := name[i-1] >= 'A' && name[i-1] <= 'Z'
+		upper := name[i] >= 'A' && name[i] <= 'Z'
+		nextLower := i+1 < len(name) && name[i+1] >= 'a' && name[i+1] <= 'z'
+		if upper && (!prevUpper || nextLower) {
+			words = append(words, strings.ToLower(name[start:i]))
+			start = i
+		}
+	}
+	return append(words, strings.ToLower(name[start:]))
+}
+
+// TestEMVDataMatchesDictionary checks that every emv struct tag in EMVData is
+// in EMVTagFormats and that the field's JSON name is made of words from the
+// dictionary description, so a new field cannot point at the wrong tag
+func TestEMVDataMatchesDictionary(t *testing.T) {
+	structType := reflect.TypeOf(EMVData{})
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, _ := parseEMVTag(field.Tag.Get("emv"))
+		if tag == "" {
+			continue
+		}
+
+		format, ok := EMVTagFormats[tag]
+		if !ok {
+			t.Errorf("Field %s: tag %s is not in EMVTagFormats", field.Name, tag)
+			continue
+		}
+
+		// Compare against the description without spaces and punctuation
+		var description, initials strings.Builder
+		for i, c := range strings.ToLower(format.Description) {
+			if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+				description.WriteRune(c)
+				if i == 0 || format.Description[i-1] == ' ' {
+					initials.WriteRune(c)
+				}
+			}
+		}
+
+		// A name may also be the abbreviation of the description
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if strings.EqualFold(jsonName, initials.String()) {
+			continue
+		}
+		for _, word := range camelWords(jsonName) {
+			if !strings.Contains(description.String(), word) {
+				t.Errorf("Field %s: JSON name %q does not match tag %s (%s)", field.Name, jsonName, tag, format.Description)
+				break
+			}
+		}
+	}
+}
+
+func TestCamelWords(t *testing.T) {
+	tests := map[string]string{
+		"applicationVersionNumberICC":       "application,version,number,icc",
+		"iccPublicKeyExponent":              "icc,public,key,exponent",
+		"track2EquivalentData":              "track2,equivalent,data",
+		"cardRiskManagementDataObjectList1": "card,risk,management,data,object,list1",
+	}
+
+	for name, expected := range tests {
+		if words := strings.Join(camelWords(name), ","); words != expected {
+			t.Errorf("Expected %s for %s, got: %s", expected, name, words)
+		}
+	}
+}
+
+// Authorization DE55 used by the benchmarks
+const benchmarkDE55 = "9F2608D0C669EEB70C58DD9F2701809F100706011203A000009F3704123456789F360200699505000000800" +
+	"09A032510169C01009F02060000000010005F2A020840820220009F1A0208409F03060000000000009F34031E03009F35012" +
+	"29F1E0831323334353637388407A00000000310109F090200969F3303E0F8C89F4104000000015F340101"
+
+func BenchmarkParse(b *testing.B) {
+	data, err := hex.DecodeString(benchmarkDE55)
+	if err != nil {
+		b.Fatalf("Error decoding hex: %v", err)
+	}
+
+	parser := NewEMVParser()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := parser.Parse(data); err != nil {
+			b.Fatalf("Error parsing EMV data: %v", err)
+		}
+	}
+}
+
+func TestFormatValueForTag(t *testing.T) {
+	// The dictionary has no fixed-length cn tag
+	registry := NewTagRegistry(DefaultTagRegistry)
+	if err := registry.Register("DF01", EMVTagFormat{MinLength: 6, MaxLength: 6, Format: "cn"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		tag      string
+		value    string
+		expected string
+		kind     error
+	}{
+		{"n is padded with leading zeros", "9F02", "0100", "000000000100", nil},
+		{"cn is padded with trailing F", "DF01", "41111111", "41111111FFFF", nil},
+		{"an is padded with trailing spaces", "9F1E", "31323334", "3132333420202020", nil},
+		{"ans is padded with trailing spaces", "9F16", "4D45524348", "4D4552434820202020202020202020", nil},
+		{"b is padded on the PadLeft side", "9F26", "0102", "0000000000000102", nil},
+		{"full-length values are kept", "9F1A", "0840", "0840", nil},
+		{"too long", "9F1A", "000840", "", ErrValueLength},
+		{"invalid BCD", "9F02", "00000000010A", "", ErrInvalidNumeric},
+		{"invalid character", "9F1E", "3132330A", "", ErrInvalidCharacter},
+		{"space inside an an value", "9F1E", "31203233", "", ErrInvalidCharacter},
+	}
+
+	for _, tt := range tests {
+		value, err := formatValueForTag(mustDecodeHex(t, tt.value), registry.Format(tt.tag))
+		if tt.kind != nil {
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.name, err)
+		} else if got := fmt.Sprintf("%X", value); got != tt.expected {
+			t.Errorf("%s: expected %s, got: %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestMarshalRejectsInvalidValues(t *testing.T) {
+	data := &EMVData{
+		ApplicationCryptogram: mustDecodeHex(t, "D0C669EEB70C58DD"),
+		AmountAuthorized:      mustDecodeHex(t, "0000000010000A"),
+	}
+
+	_, err := NewEMVParser().Marshal(data)
+	var encodeErr *EncodeError
+	if !errors.As(err, &encodeErr) || !errors.Is(err, ErrValueLength) {
+		t.Fatalf("Expected an *EncodeError for the amount, got: %v", err)
+	}
+	if encodeErr.Field != "AmountAuthorized" || encodeErr.Tag != "9F02" {
+		t.Errorf("Expected field AmountAuthorized (tag 9F02), got: %s (tag %s)", encodeErr.Field, encodeErr.Tag)
+	}
+}
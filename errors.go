@@ -0,0 +1,132 @@
+package emvparser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wadearnold/kernel/tlv"
+)
+
+// Kinds of malformed TLV data reported in a ParseError. Use errors.Is to test
+// for them. Those shared with package tlv are the same values.
+var (
+	// ErrTruncatedTag means the data ended inside a tag
+	ErrTruncatedTag = tlv.ErrTruncatedTag
+
+	// ErrTruncatedLength means the data ended inside a length
+	ErrTruncatedLength = tlv.ErrTruncatedLength
+
+	// ErrTruncatedValue means the data ended before the value was complete
+	ErrTruncatedValue = tlv.ErrTruncatedValue
+
+	// ErrInvalidLength means the length is not a valid definite-form length
+	ErrInvalidLength = tlv.ErrInvalidLength
+
+	// ErrTagTooLong means a tag has more than four bytes
+	ErrTagTooLong = tlv.ErrTagTooLong
+
+	// ErrPadding means 00 or FF padding bytes were found where a tag was
+	// expected. It is only reported in ParseStrict and ParseLenient mode.
+	ErrPadding = errors.New("padding between data objects")
+
+	// ErrNonMinimalLength means a length used more bytes than needed, such
+	// as 81 05. It is only reported in ParseStrict and ParseLenient mode.
+	ErrNonMinimalLength = errors.New("non-minimal length encoding")
+
+	// ErrDepthLimit means templates are nested deeper than ParseOptions.MaxDepth
+	ErrDepthLimit = tlv.ErrDepthLimit
+
+	// ErrTLVLimit means the data holds more than ParseOptions.MaxTLVs data objects
+	ErrTLVLimit = errors.New("maximum number of data objects exceeded")
+
+	// ErrValueTooLong means a length exceeds ParseOptions.MaxValueLength
+	ErrValueTooLong = tlv.ErrValueTooLong
+
+	// ErrLengthOverflow means a length uses more than
+	// ParseOptions.MaxLengthBytes bytes or does not fit in an int
+	ErrLengthOverflow = tlv.ErrLengthOverflow
+)
+
+// ParseError describes malformed TLV data. In ParseLenient mode the same
+// type describes the leniencies that were applied.
+type ParseError struct {
+	// Offset is the byte offset in the input of the tag, length or value
+	// that could not be read
+	Offset int
+
+	// Tag is the tag of the data object being read, empty if the tag itself
+	// could not be read
+	Tag string
+
+	// Path lists the templates enclosing the data object, e.g. "6F/A5/BF0C/61",
+	// empty at the top level
+	Path string
+
+	// Err is the kind of error, such as ErrTruncatedValue or ErrPadding
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+	if e.Tag != "" {
+		msg += " (tag " + e.Tag
+		if e.Path != "" {
+			msg += " in " + e.Path
+		}
+		msg += ")"
+	} else if e.Path != "" {
+		msg += " (in " + e.Path + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the kind of error, so errors.Is works with the sentinel errors
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError describes a struct field whose value Marshal cannot encode as
+// a valid value of its tag, even after padding, or whose MarshalEMV method
+// failed
+type EncodeError struct {
+	// Field is the Go name of the struct field
+	Field string
+
+	// Tag is the EMV tag of the field
+	Tag string
+
+	// Err describes the problem and wraps its kind, such as ErrValueLength
+	Err error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("field %s (tag %s): %v", e.Field, e.Tag, e.Err)
+}
+
+// Unwrap returns the problem, so errors.Is works with the sentinel errors
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError describes a struct field that Unmarshal or Parse could not
+// store a value in, such as a field whose UnmarshalEMV method failed
+type DecodeError struct {
+	// Field is the Go name of the struct field
+	Field string
+
+	// Tag is the EMV tag of the field
+	Tag string
+
+	// Err is the error returned while decoding the value
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("field %s (tag %s): %v", e.Field, e.Tag, e.Err)
+}
+
+// Unwrap returns the error returned while decoding the value, so errors.Is
+// and errors.As reach errors from UnmarshalEMV methods
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
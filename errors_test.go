@@ -0,0 +1,68 @@
+package emvparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		kind   error
+		offset int
+		tag    string
+		path   string
+	}{
+		{"truncated tag", "9F2701809F", ErrTruncatedTag, 4, "", ""},
+		{"truncated multi-byte tag", "DF81", ErrTruncatedTag, 0, "", ""},
+		{"missing length", "9F27", ErrTruncatedLength, 2, "9F27", ""},
+		{"truncated extended length", "9F108201", ErrTruncatedLength, 2, "9F10", ""},
+		{"truncated value", "9F100706011203", ErrTruncatedValue, 3, "9F10", ""},
+		{"indefinite length", "7780", ErrInvalidLength, 1, "77", ""},
+		{"nested truncated value", "6F0CA50ABF0C0761055005564953", ErrTruncatedValue, 11, "50", "6F/A5/BF0C/61"},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeTree(mustDecodeHex(t, tt.data))
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, err)
+			continue
+		}
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: expected a *ParseError, got: %T", tt.name, err)
+			continue
+		}
+		if parseErr.Offset != tt.offset || parseErr.Tag != tt.tag || parseErr.Path != tt.path {
+			t.Errorf("%s: expected offset %d, tag %q, path %q, got: %d, %q, %q",
+				tt.name, tt.offset, tt.tag, tt.path, parseErr.Offset, parseErr.Tag, parseErr.Path)
+		}
+	}
+}
+
+func TestParseErrorFromParser(t *testing.T) {
+	_, err := NewEMVParser().Parse(mustDecodeHex(t, "770A9F2608D0C669EE"))
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a *ParseError, got: %v", err)
+	}
+	if !errors.Is(err, ErrTruncatedValue) {
+		t.Errorf("Expected ErrTruncatedValue, got: %v", parseErr.Err)
+	}
+
+	expected := "unexpected end of data when reading value at offset 2 (tag 77)"
+	if err.Error() != expected {
+		t.Errorf("Expected message %q, got: %q", expected, err.Error())
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	err := &ParseError{Offset: 25, Tag: "4F", Path: "6F/A5/BF0C/61", Err: ErrTruncatedValue}
+	expected := "unexpected end of data when reading value at offset 25 (tag 4F in 6F/A5/BF0C/61)"
+	if err.Error() != expected {
+		t.Errorf("Expected message %q, got: %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,110 @@
+package emvparser
+
+import (
+	"log/slog"
+
+	"github.com/wadearnold/kernel/tlv"
+)
+
+// ParseMode selects how strictly TLV data is checked
+type ParseMode int
+
+const (
+	// ParseDefault accepts any well-formed BER-TLV data, including
+	// non-minimal lengths, skips 00 and FF padding bytes and fails on
+	// truncated data
+	ParseDefault ParseMode = iota
+
+	// ParseStrict also rejects padding bytes and non-minimal lengths
+	ParseStrict
+
+	// ParseLenient skips padding bytes, accepts non-minimal lengths and stops
+	// at truncated or trailing data instead of failing, keeping what could be
+	// decoded. Each leniency is recorded as a warning.
+	ParseLenient
+)
+
+// Default resource limits, used when the matching ParseOptions field is zero.
+// They comfortably fit real card and DE55 data.
+const (
+	DefaultMaxDepth       = tlv.DefaultMaxDepth
+	DefaultMaxTLVs        = 4096
+	DefaultMaxValueLength = tlv.DefaultMaxValueLength
+	DefaultMaxLengthBytes = tlv.DefaultMaxLengthBytes
+)
+
+// ParseOptions controls how TLV data is decoded. The limits protect against
+// hostile input and are enforced in every mode; a zero limit selects its
+// default.
+type ParseOptions struct {
+	// Mode selects strict, lenient or default checking
+	Mode ParseMode
+
+	// MaxDepth is the deepest nesting of constructed data objects allowed;
+	// top-level data objects are at depth 1
+	MaxDepth int
+
+	// MaxTLVs is the maximum number of data objects, counting those inside
+	// templates
+	MaxTLVs int
+
+	// MaxValueLength is the maximum length of a single value
+	MaxValueLength int
+
+	// MaxLengthBytes is the maximum number of bytes following 81-FF in the
+	// long form of a length
+	MaxLengthBytes int
+}
+
+// limit returns n, or def when n is zero
+func limit(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
+
+// ParserOption configures an EMVParser
+type ParserOption func(*EMVParser)
+
+// WithLogger sends parser diagnostics, such as tags that have no EMVData
+// field, to logger at debug level. Without it the parser logs nothing.
+func WithLogger(logger *slog.Logger) ParserOption {
+	return func(parser *EMVParser) {
+		parser.logger = logger
+	}
+}
+
+// WithTagOrder sets the order in which Marshal emits tags. The default is
+// ParsedOrder.
+func WithTagOrder(order TagOrder) ParserOption {
+	return func(parser *EMVParser) {
+		parser.order = order
+	}
+}
+
+// WithTagRegistry sets the tag formats used to decode and encode values and
+// to decide which tags Marshal emits. The default is DefaultTagRegistry.
+func WithTagRegistry(registry *TagRegistry) ParserOption {
+	return func(parser *EMVParser) {
+		parser.registry = registry
+	}
+}
+
+// WithValidation makes Parse check every value whose tag is in the parser's
+// TagRegistry against the tag's length range and EMV data format. Values that
+// do not match are still parsed; each problem is listed in
+// EMVData.Violations.
+func WithValidation() ParserOption {
+	return func(parser *EMVParser) {
+		parser.validate = true
+	}
+}
+
+// WithParseOptions sets how Parse decodes data. Warnings from ParseLenient
+// mode are returned in EMVData.Warnings.
+func WithParseOptions(opts ParseOptions) ParserOption {
+	return func(parser *EMVParser) {
+		parser.parseOpts = opts
+	}
+}
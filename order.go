@@ -0,0 +1,66 @@
+package emvparser
+
+import "sort"
+
+// TagOrder decides the order in which EMVParser.Marshal emits data objects.
+// Whatever the order, Marshal produces byte-identical output for identical
+// input.
+type TagOrder struct {
+	// ascending sorts tags by their encoded bytes
+	ascending bool
+
+	// sequence lists tags that are emitted first, in this order
+	sequence []string
+}
+
+var (
+	// ParsedOrder emits tags in the order Parse found them. Tags that were
+	// not parsed, such as fields set by hand, follow in EMVData field order
+	// and then in Extra order. This is the default.
+	ParsedOrder = TagOrder{}
+
+	// AscendingOrder emits tags sorted by their encoded bytes
+	AscendingOrder = TagOrder{ascending: true}
+)
+
+// SchemeOrder emits the given tags first, in the given order. Tags that are
+// not listed follow in ParsedOrder. Use it for the DE55 sequence a card
+// scheme or acquirer specifies, e.g.
+//
+//	NewEMVParser(WithTagOrder(SchemeOrder("9F26", "9F27", "9F10", "9F37", "9F36", "95")))
+func SchemeOrder(tags ...string) TagOrder {
+	return TagOrder{sequence: tags}
+}
+
+// sortTLVs sorts nodes in place. parsed lists tags in the order Parse found
+// them; nodes must already be in EMVData field order.
+func (order TagOrder) sortTLVs(nodes TLVList, parsed []string) {
+	if order.ascending {
+		// Hex strings of whole bytes compare like the bytes they encode
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].Tag < nodes[j].Tag
+		})
+		return
+	}
+
+	rank := make(map[string]int, len(order.sequence)+len(parsed))
+	for _, tag := range parsed {
+		if _, ok := rank[tag]; !ok {
+			rank[tag] = len(order.sequence) + len(rank)
+		}
+	}
+	for i, tag := range order.sequence {
+		rank[tag] = i
+	}
+
+	// Tags with no rank keep their position after all ranked tags
+	key := func(tag string) int {
+		if r, ok := rank[tag]; ok {
+			return r
+		}
+		return len(order.sequence) + len(parsed)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return key(nodes[i].Tag) < key(nodes[j].Tag)
+	})
+}
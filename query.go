@@ -0,0 +1,171 @@
+package emvparser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Errors reported by the query and edit methods of TLVList. Use errors.Is to
+// test for them.
+var (
+	// ErrInvalidPath means a query path is malformed
+	ErrInvalidPath = errors.New("invalid query path")
+
+	// ErrNoMatch means no data object was found at a path
+	ErrNoMatch = errors.New("no data object at path")
+
+	// ErrAmbiguousPath means a path that must select a single data object
+	// matched several
+	ErrAmbiguousPath = errors.New("path matches more than one data object")
+)
+
+// Match is a data object found by TLVList.Query
+type Match struct {
+	// Node is the matching data object
+	Node *TLV
+
+	// Path locates Node within the tree, giving for every step the index of
+	// the data object among its siblings with the same tag, e.g.
+	// "6F[0]/A5[0]/BF0C[0]/61[1]/4F[0]". It is a valid query path that
+	// matches only Node.
+	Path string
+}
+
+// location is where a data object found by a query sits in the tree
+type location struct {
+	// ancestors are the templates enclosing the data object, outermost first
+	ancestors []*TLV
+
+	// siblings is the list holding the data object, at index
+	siblings *TLVList
+	index    int
+
+	// path is the path reported in Match.Path
+	path string
+}
+
+// node returns the data object at the location
+func (loc location) node() *TLV {
+	return (*loc.siblings)[loc.index]
+}
+
+// pathStep is a single step of a query path
+type pathStep struct {
+	// tag is the tag as an uppercase hex string
+	tag string
+
+	// index selects the occurrence of tag among its siblings, or is -1 to
+	// select them all
+	index int
+}
+
+// Query returns the data objects at path, in input order. A path lists the
+// tags from the top level down, separated by slashes, such as "77/9F10" or
+// "6F/A5/BF0C/61[*]/4F". A step without an index, or with [*], matches every
+// occurrence of its tag among the siblings; [n] matches only the n-th
+// occurrence, counting from 0. A path that matches nothing returns no
+// matches and a nil error.
+func (l TLVList) Query(path string) ([]Match, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	for _, loc := range l.locate(steps, nil, "", nil) {
+		matches = append(matches, Match{Node: loc.node(), Path: loc.path})
+	}
+	return matches, nil
+}
+
+// QueryFirst returns the first data object at path, or nil if there is none
+func (l TLVList) QueryFirst(path string) (*TLV, error) {
+	matches, err := l.Query(path)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	return matches[0].Node, nil
+}
+
+// locate appends the locations of the data objects in l matching steps to
+// locs. The list is enclosed by ancestors, whose path is prefix.
+func (l *TLVList) locate(steps []pathStep, ancestors []*TLV, prefix string, locs []location) []location {
+	step := steps[0]
+
+	n := 0
+	for i, node := range *l {
+		if node.Tag != step.tag {
+			continue
+		}
+		index := n
+		n++
+		if step.index >= 0 && step.index != index {
+			continue
+		}
+
+		path := node.Tag + "[" + strconv.Itoa(index) + "]"
+		if prefix != "" {
+			path = prefix + "/" + path
+		}
+
+		if len(steps) == 1 {
+			locs = append(locs, location{ancestors: ancestors, siblings: l, index: i, path: path})
+		} else {
+			inner := append(ancestors[:len(ancestors):len(ancestors)], node)
+			locs = node.Children.locate(steps[1:], inner, path, locs)
+		}
+	}
+
+	return locs
+}
+
+// parsePath splits a query path into its steps
+func parsePath(path string) ([]pathStep, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+
+	var steps []pathStep
+	for _, segment := range strings.Split(path, "/") {
+		step := pathStep{tag: segment, index: -1}
+
+		if tag, selector, ok := strings.Cut(segment, "["); ok {
+			selector, ok = strings.CutSuffix(selector, "]")
+			if !ok {
+				return nil, fmt.Errorf("%w: unterminated index in %q", ErrInvalidPath, segment)
+			}
+			step.tag = tag
+			if selector != "*" {
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("%w: bad index in %q", ErrInvalidPath, segment)
+				}
+				step.index = index
+			}
+		}
+
+		if !validHexTag(step.tag) {
+			return nil, fmt.Errorf("%w: bad tag %q", ErrInvalidPath, step.tag)
+		}
+		step.tag = strings.ToUpper(step.tag)
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// validHexTag reports whether tag is a non-empty string of whole hex bytes
+// of at most four bytes
+func validHexTag(tag string) bool {
+	if tag == "" || len(tag)%2 != 0 || len(tag) > 8 {
+		return false
+	}
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package emvparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	// PPSE response with two application entries (61) under BF0C
+	nodes, err := DecodeTree(mustDecodeHex(t, "6F31840E325041592E5359532E4444463031A51FBF0C1C610C4F07A0000000031010870101610C4F07A0000000032010870102"))
+	if err != nil {
+		t.Fatalf("Error decoding TLV tree: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+		values   []string
+	}{
+		{"6F/A5/BF0C/61[*]/4F", []string{"6F[0]/A5[0]/BF0C[0]/61[0]/4F[0]", "6F[0]/A5[0]/BF0C[0]/61[1]/4F[0]"}, []string{"A0000000031010", "A0000000032010"}},
+		{"6F/A5/BF0C/61/87", []string{"6F[0]/A5[0]/BF0C[0]/61[0]/87[0]", "6F[0]/A5[0]/BF0C[0]/61[1]/87[0]"}, []string{"01", "02"}},
+		{"6f/a5/bf0c/61[1]/4f", []string{"6F[0]/A5[0]/BF0C[0]/61[1]/4F[0]"}, []string{"A0000000032010"}},
+		{"6F/84", []string{"6F[0]/84[0]"}, []string{"325041592E5359532E4444463031"}},
+		{"6F/A5/BF0C/61[2]/4F", nil, nil},
+		{"77/9F10", nil, nil},
+	}
+
+	for _, tt := range tests {
+		matches, err := nodes.Query(tt.path)
+		if err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.path, err)
+			continue
+		}
+		if len(matches) != len(tt.expected) {
+			t.Errorf("%s: expected %d matches, got: %d", tt.path, len(tt.expected), len(matches))
+			continue
+		}
+		for i, match := range matches {
+			if match.Path != tt.expected[i] || !bytesEqual(match.Node.Value, mustDecodeHex(t, tt.values[i])) {
+				t.Errorf("%s: expected %s=%s, got: %s=%X", tt.path, tt.expected[i], tt.values[i], match.Path, match.Node.Value)
+			}
+
+			// The reported path finds the same node again
+			again, err := nodes.Query(match.Path)
+			if err != nil || len(again) != 1 || again[0].Node != match.Node {
+				t.Errorf("%s: expected %s to match only its node, got: %v (%v)", tt.path, match.Path, again, err)
+			}
+		}
+	}
+}
+
+func TestQueryFirst(t *testing.T) {
+	nodes, err := DecodeTree(mustDecodeHex(t, "77139F2701809F100706011203A000009F36020001"))
+	if err != nil {
+		t.Fatalf("Error decoding TLV tree: %v", err)
+	}
+
+	node, err := nodes.QueryFirst("77/9F10")
+	if err != nil || node == nil || node.Offset != 6 {
+		t.Errorf("Expected 9F10 at offset 6, got: %v (%v)", node, err)
+	}
+
+	if node, err := nodes.QueryFirst("77/9F26"); node != nil || err != nil {
+		t.Errorf("Expected no match and no error, got: %v (%v)", node, err)
+	}
+}
+
+func TestQueryInvalidPath(t *testing.T) {
+	for _, path := range []string{"", "77/", "7/9F10", "77/9F10[", "77/9F10[x]", "77/9F10[-1]", "GG"} {
+		if _, err := (TLVList{}).Query(path); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: expected %v, got: %v", path, ErrInvalidPath, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package emvparser
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrImmutableRegistry means Register was called on DefaultTagRegistry
+var ErrImmutableRegistry = errors.New("tag registry is immutable")
+
+// TagRegistry holds the EMVTagFormat of each tag. A registry can extend a
+// parent registry, overriding some of its entries and adding others, so a
+// service can hold different tag definitions per acquirer:
+//
+//	acquirer := NewTagRegistry(DefaultTagRegistry)
+//	acquirer.Register("DF8101", EMVTagFormat{Format: "b", Description: "Acquirer Data", DE55: true})
+//	parser := NewEMVParser(WithTagRegistry(acquirer))
+//
+// A TagRegistry is safe for concurrent use; Register may be called while
+// other goroutines look tags up.
+type TagRegistry struct {
+	parent *TagRegistry
+
+	// formats is replaced as a whole by Register, so lookups never lock
+	formats atomic.Pointer[map[string]EMVTagFormat]
+
+	// mu serialises Register calls
+	mu sync.Mutex
+
+	// immutable makes Register fail
+	immutable bool
+}
+
+// DefaultTagRegistry holds the tags of EMVTagFormats as it was defined by the
+// package. It is used when no other registry is configured and cannot be
+// changed, not even through EMVTagFormats.
+var DefaultTagRegistry = newImmutableRegistry(cloneFormats(EMVTagFormats))
+
+// NewTagRegistry returns an empty registry that falls back to parent for the
+// tags it does not define. parent may be nil.
+func NewTagRegistry(parent *TagRegistry) *TagRegistry {
+	r := &TagRegistry{parent: parent}
+	r.formats.Store(&map[string]EMVTagFormat{})
+	return r
+}
+
+// newImmutableRegistry returns a registry holding formats, which must not be
+// changed afterwards
+func newImmutableRegistry(formats map[string]EMVTagFormat) *TagRegistry {
+	r := &TagRegistry{immutable: true}
+	r.formats.Store(&formats)
+	return r
+}
+
+// Lookup returns the format of tag, such as "9F26", from the registry or the
+// nearest parent defining it. The format is a copy, so changing its Templates
+// does not change the registry.
+func (r *TagRegistry) Lookup(tag string) (EMVTagFormat, bool) {
+	format, ok := r.lookup(tag)
+	return cloneFormat(format), ok
+}
+
+// Format returns the format of tag, falling back to the DEFAULT entry for
+// tags that are not registered. Like Lookup it returns a copy.
+func (r *TagRegistry) Format(tag string) EMVTagFormat {
+	return cloneFormat(r.format(tag))
+}
+
+// lookup is Lookup without the copy, for callers in this package that only
+// read the format
+func (r *TagRegistry) lookup(tag string) (EMVTagFormat, bool) {
+	tag = strings.ToUpper(tag)
+	for ; r != nil; r = r.parent {
+		if format, ok := (*r.formats.Load())[tag]; ok {
+			return format, true
+		}
+	}
+	return EMVTagFormat{}, false
+}
+
+// format is Format without the copy, for callers in this package that only
+// read the format
+func (r *TagRegistry) format(tag string) EMVTagFormat {
+	if format, ok := r.lookup(tag); ok {
+		return format
+	}
+	format, _ := r.lookup("DEFAULT")
+	return format
+}
+
+// Register sets the format of tag, overriding any format the parent
+// registries define for it. The registry keeps a copy of format.
+func (r *TagRegistry) Register(tag string, format EMVTagFormat) error {
+	if r.immutable {
+		return ErrImmutableRegistry
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	formats := maps.Clone(*r.formats.Load())
+	formats[strings.ToUpper(tag)] = cloneFormat(format)
+	r.formats.Store(&formats)
+	return nil
+}
+
+// cloneFormat returns format with its own copy of Templates
+func cloneFormat(format EMVTagFormat) EMVTagFormat {
+	format.Templates = slices.Clone(format.Templates)
+	return format
+}
+
+// cloneFormats returns a copy of formats that shares no Templates slice with
+// it
+func cloneFormats(formats map[string]EMVTagFormat) map[string]EMVTagFormat {
+	clone := make(map[string]EMVTagFormat, len(formats))
+	for tag, format := range formats {
+		clone[tag] = cloneFormat(format)
+	}
+	return clone
+}
+
+// Tags returns the tags defined by the registry and its parents, sorted
+func (r *TagRegistry) Tags() []string {
+	seen := make(map[string]bool)
+	for ; r != nil; r = r.parent {
+		for tag := range *r.formats.Load() {
+			seen[tag] = true
+		}
+	}
+
+	tags := make([]string, 0, len(seen))
+	for tag := range seen {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
@@ -0,0 +1,142 @@
+package emvparser
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestTagRegistry(t *testing.T) {
+	if format, ok := DefaultTagRegistry.Lookup("9F26"); !ok || format.Description != "Application Cryptogram" {
+		t.Errorf("Expected the default registry to define 9F26, got: %+v", format)
+	}
+	if err := DefaultTagRegistry.Register("9F26", EMVTagFormat{}); !errors.Is(err, ErrImmutableRegistry) {
+		t.Errorf("Expected %v, got: %v", ErrImmutableRegistry, err)
+	}
+
+	// A custom registry overrides and extends the default one
+	registry := NewTagRegistry(DefaultTagRegistry)
+	if err := registry.Register("9f1a", EMVTagFormat{MinLength: 2, MaxLength: 2, Format: "n", Description: "Acquirer Country"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := registry.Register("DF8101", EMVTagFormat{Format: "b", Description: "Acquirer Data", DE55: true}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		registry    *TagRegistry
+		tag         string
+		description string
+		ok          bool
+	}{
+		{registry, "9F1A", "Acquirer Country", true},
+		{registry, "DF8101", "Acquirer Data", true},
+		{registry, "9F26", "Application Cryptogram", true},
+		{DefaultTagRegistry, "9F1A", "Terminal Country Code", true},
+		{DefaultTagRegistry, "DF8101", "", false},
+	}
+	for _, tt := range tests {
+		format, ok := tt.registry.Lookup(tt.tag)
+		if ok != tt.ok || format.Description != tt.description {
+			t.Errorf("%s: expected %q (%v), got: %q (%v)", tt.tag, tt.description, tt.ok, format.Description, ok)
+		}
+	}
+
+	if format := registry.Format("DF7F"); format.Description != "Default Tag Format" {
+		t.Errorf("Expected unknown tags to use the DEFAULT entry, got: %+v", format)
+	}
+	if tags := registry.Tags(); len(tags) != len(DefaultTagRegistry.Tags())+1 {
+		t.Errorf("Expected one more tag than the default registry, got: %d", len(tags))
+	}
+}
+
+func TestTagRegistryCopiesTemplates(t *testing.T) {
+	// Changing the deprecated map must not reach the default registry
+	saved := EMVTagFormats["9F26"].Templates[0]
+	EMVTagFormats["9F26"].Templates[0] = "XX"
+	defer func() { EMVTagFormats["9F26"].Templates[0] = saved }()
+	if format, _ := DefaultTagRegistry.Lookup("9F26"); format.Templates[0] != saved {
+		t.Errorf("Expected template %s after changing EMVTagFormats, got: %s", saved, format.Templates[0])
+	}
+
+	// Nor may changing a looked up format
+	format, _ := DefaultTagRegistry.Lookup("9F26")
+	format.Templates[0] = "XX"
+	if format := DefaultTagRegistry.Format("9F26"); format.Templates[0] != saved {
+		t.Errorf("Expected template %s after changing a looked up format, got: %s", saved, format.Templates[0])
+	}
+
+	// Or the format passed to Register
+	registry := NewTagRegistry(nil)
+	templates := []string{"77"}
+	if err := registry.Register("DF01", EMVTagFormat{Format: "b", Templates: templates}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	templates[0] = "XX"
+	if format, _ := registry.Lookup("DF01"); format.Templates[0] != "77" {
+		t.Errorf("Expected template 77 after changing the registered slice, got: %s", format.Templates[0])
+	}
+}
+
+func TestParserTagRegistry(t *testing.T) {
+	// DF8101 is not in the default registry, so Marshal keeps it as an
+	// unknown tag; 9F1E is excluded from DE55 by the custom registry
+	registry := NewTagRegistry(DefaultTagRegistry)
+	if err := registry.Register("9F1E", EMVTagFormat{MinLength: 8, MaxLength: 8, Format: "an", DE55: false}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := registry.Register("9F02", EMVTagFormat{MinLength: 8, MaxLength: 8, PadLeft: true, Format: "n", DE55: true}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	data := mustDecodeHex(t, "9F1E0831323334353637389F0203000100DF810101AA")
+
+	tests := []struct {
+		name     string
+		parser   *EMVParser
+		expected string
+	}{
+		{"default registry", NewEMVParser(), "9F1E0831323334353637389F0206000000000100DF810101AA"},
+		{"custom registry", NewEMVParser(WithTagRegistry(registry)), "9F02080000000000000100DF810101AA"},
+	}
+
+	for _, tt := range tests {
+		parsed, err := tt.parser.Parse(data)
+		if err != nil {
+			t.Fatalf("%s: error parsing EMV data: %v", tt.name, err)
+		}
+		encoded, err := tt.parser.Marshal(parsed)
+		if err != nil {
+			t.Fatalf("%s: error marshaling EMV data: %v", tt.name, err)
+		}
+		if got := fmt.Sprintf("%X", encoded); got != tt.expected {
+			t.Errorf("%s: expected %s, got: %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestTagRegistryConcurrent(t *testing.T) {
+	registry := NewTagRegistry(DefaultTagRegistry)
+	parser := NewEMVParser(WithTagRegistry(registry))
+	data := mustDecodeHex(t, "9F2701809F360200019F1A020840")
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				if i == 0 {
+					registry.Register(fmt.Sprintf("DF81%02X", j), EMVTagFormat{Format: "b"})
+					continue
+				}
+				if _, err := parser.Parse(data); err != nil {
+					t.Errorf("Error parsing EMV data: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
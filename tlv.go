@@ -0,0 +1,397 @@
+package emvparser
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/wadearnold/kernel/tlv"
+)
+
+// TLV is a single BER-TLV data object, keeping its position in the input
+// and, for constructed tags, the data objects nested inside it
+type TLV struct {
+	// Tag is the tag as an uppercase hex string, e.g. "9F10"
+	Tag string `json:"tag"`
+
+	// Length is the length of Value in bytes
+	Length int `json:"length"`
+
+	// Value is the raw value; for constructed tags it holds the encoded children
+	Value []byte `json:"value"`
+
+	// Children are the data objects of a constructed tag, in input order
+	Children TLVList `json:"children,omitempty"`
+
+	// Offset is the byte offset of the first tag byte within the decoded data
+	Offset int `json:"offset"`
+
+	// Header holds the tag and length bytes exactly as they were decoded, so
+	// MarshalRaw can reproduce non-minimal lengths such as 81 05. It is nil
+	// for data objects built by hand.
+	Header []byte `json:"-"`
+
+	// Padding holds the 00 and FF padding bytes skipped before the data
+	// object
+	Padding []byte `json:"-"`
+
+	// TrailingPadding holds the padding skipped after the data object when
+	// it is the last one of its template or of the input. In ParseLenient
+	// mode it also holds the truncated or trailing bytes that could not be
+	// decoded.
+	TrailingPadding []byte `json:"-"`
+}
+
+// TLVList is an ordered sequence of sibling data objects
+type TLVList []*TLV
+
+// Constructed reports whether the tag is a constructed data object (b6 of
+// the first tag byte is set)
+func (t *TLV) Constructed() bool {
+	return len(t.Tag) >= 2 && (hexNibble(t.Tag[0])<<4|hexNibble(t.Tag[1]))&0x20 != 0
+}
+
+// DecodeTree decodes BER-TLV data into a tree that mirrors the input exactly:
+// sibling order and duplicate tags are preserved, and constructed tags such as
+// 77, 6F and A5 keep their children. Malformed data is reported as a
+// *ParseError.
+func DecodeTree(data []byte) (TLVList, error) {
+	nodes, _, err := ParseOptions{}.DecodeTree(data)
+	return nodes, err
+}
+
+// DecodeTree decodes BER-TLV data like the package-level DecodeTree, checking
+// it according to the options. In ParseLenient mode it also returns the
+// leniencies that were applied, in input order.
+func (opts ParseOptions) DecodeTree(data []byte) (TLVList, []*ParseError, error) {
+	d := newTreeDecoder(opts)
+	nodes, err := d.decode(data, 0, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes, d.warnings, nil
+}
+
+// treeDecoder holds the state of a single decoding pass over nested TLV data,
+// which is read with a tlv.Iterator per template
+type treeDecoder struct {
+	opts     ParseOptions
+	warnings []*ParseError
+
+	// Resource limits, with defaults applied
+	maxDepth       int
+	maxTLVs        int
+	maxValueLength int
+	maxLengthBytes int
+
+	// count is the number of data objects decoded so far
+	count int
+
+	// path holds the tags of the templates enclosing the data objects being
+	// decoded
+	path []uint32
+
+	// registry holds the formats decodeStruct decodes values with
+	registry *TagRegistry
+
+	// unknown, when not nil, receives the data objects that decodeStruct
+	// finds no field for, templates with their children
+	unknown func(*TLV)
+
+	// validate makes decodeStruct check values against their format,
+	// collecting the problems in violations
+	validate   bool
+	violations []*ValidationError
+
+	// keepOrder makes decodeStruct record the tags of the data objects it
+	// stores in fields or in the unknown field, in input order
+	keepOrder bool
+	order     []string
+
+	// consumed counts the data objects decodeStruct stored in fields, so a
+	// template without a field can tell whether any of its children were
+	consumed int
+}
+
+// newTreeDecoder returns a treeDecoder applying opts
+func newTreeDecoder(opts ParseOptions) *treeDecoder {
+	return &treeDecoder{
+		opts:           opts,
+		registry:       DefaultTagRegistry,
+		maxDepth:       limit(opts.MaxDepth, DefaultMaxDepth),
+		maxTLVs:        limit(opts.MaxTLVs, DefaultMaxTLVs),
+		maxValueLength: limit(opts.MaxValueLength, DefaultMaxValueLength),
+		maxLengthBytes: limit(opts.MaxLengthBytes, DefaultMaxLengthBytes),
+	}
+}
+
+// decode decodes data whose first byte sits at offset base of the original
+// input, nested depth templates deep
+func (d *treeDecoder) decode(data []byte, base, depth int) (TLVList, error) {
+	var nodes TLVList
+
+	it := d.iterator(data)
+	for {
+		// Anything skipped between data objects is padding
+		pos := it.Pos()
+		ok, err := d.next(it, base, depth)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			// Keep the trailing padding and, in lenient mode, the bytes
+			// that could not be decoded, so MarshalRaw can emit them again
+			if len(nodes) > 0 && len(data) > pos {
+				nodes[len(nodes)-1].TrailingPadding = data[pos:]
+			}
+			return nodes, nil
+		}
+
+		node := &TLV{
+			Tag:    tlv.FormatTag(it.Tag()),
+			Length: len(it.Value()),
+			Value:  it.Value(),
+			Offset: base + it.Offset(),
+			Header: it.Header(),
+		}
+		if it.Offset() > pos {
+			node.Padding = data[pos:it.Offset()]
+		}
+
+		if tlv.Constructed(it.Tag()) {
+			// This is a constructed tag, recursively decode its value
+			d.enter(it.Tag())
+			node.Children, err = d.decode(it.Value(), base+it.Offset()+len(it.Header()), depth+1)
+			d.leave()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		nodes = append(nodes, node)
+	}
+}
+
+// iterator returns a tlv.Iterator over data that applies the value and
+// length limits
+func (d *treeDecoder) iterator(data []byte) *tlv.Iterator {
+	it := tlv.NewIterator(data)
+	it.MaxValueLength = d.maxValueLength
+	it.MaxLengthBytes = d.maxLengthBytes
+	return it
+}
+
+// next advances it to the next data object of a template whose value starts
+// at offset base of the input, applying the parse mode and the resource
+// limits. It returns false with a nil error at the end of the template and,
+// in lenient mode, at malformed data that was recorded as a warning.
+func (d *treeDecoder) next(it *tlv.Iterator, base, depth int) (bool, error) {
+	// Padding may appear before, between and after data objects. Default
+	// mode skips it silently.
+	if pos := it.Pos(); it.SkipPadding() > 0 && d.opts.Mode != ParseDefault {
+		if err := d.fail(&ParseError{Offset: base + pos, Path: d.pathString(), Err: ErrPadding}); err != nil {
+			return false, err
+		}
+	}
+
+	if !it.Next() {
+		if it.Err() == nil {
+			return false, nil
+		}
+		return false, d.iteratorError(it.Err(), base)
+	}
+
+	if depth > d.maxDepth {
+		return false, &ParseError{Offset: base + it.Offset(), Path: d.pathString(), Err: ErrDepthLimit}
+	}
+
+	d.count++
+	if d.count > d.maxTLVs {
+		return false, &ParseError{Offset: base + it.Offset(), Path: d.pathString(), Err: ErrTLVLimit}
+	}
+
+	// The long form is only needed for lengths of 128 and above, and then
+	// without leading zero bytes
+	tagSize := tlv.TagSize(it.Tag())
+	if length := it.Header()[tagSize:]; len(length) > 1 && (len(it.Value()) < 128 || length[1] == 0) && d.opts.Mode != ParseDefault {
+		err := &ParseError{Offset: base + it.Offset() + tagSize, Tag: tlv.FormatTag(it.Tag()), Path: d.pathString(), Err: ErrNonMinimalLength}
+		if d.opts.Mode == ParseStrict {
+			return false, err
+		}
+		d.warnings = append(d.warnings, err)
+	}
+
+	return true, nil
+}
+
+// iteratorError converts a *tlv.SyntaxError from an iterator over a template
+// whose value starts at offset base into a *ParseError. Exceeded limits are
+// errors in every mode; other malformed data is subject to the parse mode.
+func (d *treeDecoder) iteratorError(err error, base int) error {
+	syntaxErr, ok := err.(*tlv.SyntaxError)
+	if !ok {
+		return err
+	}
+
+	parseErr := &ParseError{Offset: base + int(syntaxErr.Offset), Path: d.pathString(), Err: syntaxErr.Err}
+	if syntaxErr.Tag != 0 {
+		parseErr.Tag = tlv.FormatTag(syntaxErr.Tag)
+	}
+	if syntaxErr.Err == ErrValueTooLong || syntaxErr.Err == ErrLengthOverflow {
+		return parseErr
+	}
+	return d.fail(parseErr)
+}
+
+// fail reports a problem with the data. In lenient mode the problem is
+// recorded and nil is returned so decoding can stop gracefully.
+func (d *treeDecoder) fail(err *ParseError) error {
+	if d.opts.Mode == ParseLenient {
+		d.warnings = append(d.warnings, err)
+		return nil
+	}
+	return err
+}
+
+// enter records that decoding continues inside the template with tag
+func (d *treeDecoder) enter(tag uint32) {
+	d.path = append(d.path, tag)
+}
+
+// leave records that the innermost template has been decoded
+func (d *treeDecoder) leave() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// pathString returns the enclosing templates as in ParseError.Path
+func (d *treeDecoder) pathString() string {
+	var sb strings.Builder
+	for i, tag := range d.path {
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+		sb.WriteString(tlv.FormatTag(tag))
+	}
+	return sb.String()
+}
+
+// Marshal returns the TLV encoding of the list with minimal lengths and
+// without padding. Constructed data objects with children are encoded from
+// their children, others from Value.
+func (l TLVList) Marshal() []byte {
+	return l.appendTo(nil)
+}
+
+// MarshalRaw returns the TLV encoding of the list reproducing the decoded
+// input: a list returned by DecodeTree encodes to the exact input bytes,
+// including non-minimal lengths, padding and, in ParseLenient mode, the bytes
+// that could not be decoded, unless no data object before them could. Only data
+// objects whose tag or length no longer match their Header, because they were
+// edited or built by hand, are encoded afresh, together with the templates
+// enclosing them.
+func (l TLVList) MarshalRaw() []byte {
+	return l.appendRawTo(nil)
+}
+
+// appendRawTo appends the encoding of the list to dst the way MarshalRaw
+// describes
+func (l TLVList) appendRawTo(dst []byte) []byte {
+	for _, node := range l {
+		dst = append(dst, node.Padding...)
+
+		start := len(dst)
+		if len(node.Children) > 0 {
+			dst = node.Children.appendRawTo(dst)
+		} else {
+			dst = append(dst, node.Value...)
+		}
+
+		if header := node.rawHeader(len(dst) - start); header != nil {
+			dst = slices.Insert(dst, start, header...)
+		} else {
+			dst = tlv.Wrap(dst, start, tagValue(node.Tag))
+		}
+
+		dst = append(dst, node.TrailingPadding...)
+	}
+	return dst
+}
+
+// rawHeader returns the Header of the data object if it still encodes its
+// tag and a value of length bytes, and nil otherwise
+func (t *TLV) rawHeader(length int) []byte {
+	tag := tagValue(t.Tag)
+	n := tlv.TagSize(tag)
+	if len(t.Header) <= n {
+		return nil
+	}
+
+	var headerTag uint32
+	for _, c := range t.Header[:n] {
+		headerTag = headerTag<<8 | uint32(c)
+	}
+	if headerTag != tag {
+		return nil
+	}
+
+	// The length is a single byte below 80, or 81-FF followed by that many
+	// bytes
+	lengthBytes := t.Header[n:]
+	headerLength := int(lengthBytes[0])
+	if headerLength > 0x7F {
+		if len(lengthBytes) != 1+headerLength&0x7F {
+			return nil
+		}
+		headerLength = 0
+		for _, c := range lengthBytes[1:] {
+			headerLength = headerLength<<8 | int(c)
+		}
+	} else if len(lengthBytes) != 1 {
+		return nil
+	}
+	if headerLength != length {
+		return nil
+	}
+
+	return t.Header
+}
+
+// appendTo appends the TLV encoding of the list to dst. Constructed data
+// objects with children are encoded from their children, others from Value.
+func (l TLVList) appendTo(dst []byte) []byte {
+	for _, node := range l {
+		if len(node.Children) > 0 {
+			start := len(dst)
+			dst = node.Children.appendTo(dst)
+			dst = tlv.Wrap(dst, start, tagValue(node.Tag))
+			continue
+		}
+		dst = appendTLV(dst, node.Tag, node.Value)
+	}
+	return dst
+}
+
+// find returns the first data object with tag in the tree, searching each
+// template before its following siblings, or nil
+func (l TLVList) find(tag string) *TLV {
+	for _, node := range l {
+		if node.Tag == tag {
+			return node
+		}
+		if found := node.Children.find(tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// hexNibble converts a single hex digit to its value
+func hexNibble(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
@@ -0,0 +1,212 @@
+package tlv
+
+import (
+	"bufio"
+	"io"
+	"math"
+)
+
+// Token is a single data object read by a Decoder
+type Token struct {
+	// Tag is the tag bytes big-endian, e.g. 0x9F26
+	Tag uint32
+
+	// Length is the length of the value in bytes
+	Length int
+
+	// Value is the value of the data object. It is nil for a constructed
+	// data object that the Decoder descends into, and is only valid until
+	// the next call to Next.
+	Value []byte
+
+	// Offset is the byte offset of the tag in the input
+	Offset int64
+
+	// Depth is the number of constructed data objects enclosing this one
+	Depth int
+}
+
+// Decoder reads a stream of BER-TLV data objects from an io.Reader, like
+// encoding/xml.Decoder. It holds at most one value in memory at a time, so
+// inputs of any size can be decoded with bounded memory.
+type Decoder struct {
+	// Descend makes Next return the data objects inside constructed values,
+	// with increasing Depth, instead of each constructed value as a whole
+	Descend bool
+
+	// MaxDepth is the deepest nesting of constructed values allowed when
+	// descending; top-level data objects are at depth 1. Zero selects
+	// DefaultMaxDepth.
+	MaxDepth int
+
+	// MaxValueLength is the longest value Next reads into memory. Zero
+	// selects DefaultMaxValueLength.
+	MaxValueLength int
+
+	// MaxLengthBytes is the maximum number of bytes following 81-FF in the
+	// long form of a length. Zero selects DefaultMaxLengthBytes.
+	MaxLengthBytes int
+
+	r      *bufio.Reader
+	offset int64
+
+	// ends holds the end offsets of the constructed values being descended
+	ends []int64
+
+	// buf is reused for every value
+	buf []byte
+}
+
+// NewDecoder returns a Decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// InputOffset returns the byte offset of the next data object in the input
+func (d *Decoder) InputOffset() int64 {
+	return d.offset
+}
+
+// Next returns the next data object in the input. At the end of the input it
+// returns io.EOF; malformed data is reported as a *SyntaxError.
+func (d *Decoder) Next() (Token, error) {
+	// Leave the constructed values that have been read completely
+	for len(d.ends) > 0 && d.offset >= d.ends[len(d.ends)-1] {
+		d.ends = d.ends[:len(d.ends)-1]
+	}
+
+	start := d.offset
+	tag, err := d.readTag()
+	if err == io.EOF && len(d.ends) == 0 {
+		return Token{}, io.EOF
+	} else if err == io.EOF {
+		// The input ended inside a constructed value
+		return Token{}, &SyntaxError{Offset: start, Err: ErrTruncatedValue}
+	} else if err != nil {
+		return Token{}, err
+	}
+
+	if len(d.ends)+1 > limit(d.MaxDepth, DefaultMaxDepth) {
+		return Token{}, &SyntaxError{Offset: start, Tag: tag, Err: ErrDepthLimit}
+	}
+
+	lengthOffset := d.offset
+	length, err := d.readLength(tag)
+	if err != nil {
+		return Token{}, err
+	}
+
+	// A data object may not run past the end of its template
+	if len(d.ends) > 0 && int64(length) > d.ends[len(d.ends)-1]-d.offset {
+		return Token{}, &SyntaxError{Offset: d.offset, Tag: tag, Err: ErrTruncatedValue}
+	}
+
+	token := Token{Tag: tag, Length: length, Offset: start, Depth: len(d.ends)}
+	if d.Descend && Constructed(tag) {
+		d.ends = append(d.ends, d.offset+int64(length))
+		return token, nil
+	}
+
+	if length > limit(d.MaxValueLength, DefaultMaxValueLength) {
+		return Token{}, &SyntaxError{Offset: lengthOffset, Tag: tag, Err: ErrValueTooLong}
+	}
+
+	if cap(d.buf) < length {
+		d.buf = make([]byte, length)
+	}
+	token.Value = d.buf[:length]
+	valueOffset := d.offset
+	n, err := io.ReadFull(d.r, token.Value)
+	d.offset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return Token{}, &SyntaxError{Offset: valueOffset, Tag: tag, Err: ErrTruncatedValue}
+	} else if err != nil {
+		return Token{}, err
+	}
+
+	return token, nil
+}
+
+// readTag reads a tag. It returns io.EOF when the input ends before the first
+// byte.
+func (d *Decoder) readTag() (uint32, error) {
+	start := d.offset
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.offset++
+
+	tag := uint32(b)
+	if (b & 0x1F) != 0x1F {
+		return tag, nil
+	}
+
+	// Subsequent bytes have b8 set when another byte follows
+	for size := 2; ; size++ {
+		b, err = d.r.ReadByte()
+		if err == io.EOF {
+			return 0, &SyntaxError{Offset: start, Err: ErrTruncatedTag}
+		} else if err != nil {
+			return 0, err
+		}
+		if size > 4 {
+			return 0, &SyntaxError{Offset: start, Err: ErrTagTooLong}
+		}
+		d.offset++
+
+		tag = tag<<8 | uint32(b)
+		if (b & 0x80) == 0 {
+			return tag, nil
+		}
+	}
+}
+
+// readLength reads the definite-form length of the data object with tag
+func (d *Decoder) readLength(tag uint32) (int, error) {
+	start := d.offset
+	b, err := d.r.ReadByte()
+	if err == io.EOF {
+		return 0, &SyntaxError{Offset: start, Tag: tag, Err: ErrTruncatedLength}
+	} else if err != nil {
+		return 0, err
+	}
+	d.offset++
+
+	if b == 0x80 {
+		// The indefinite form is not allowed in EMV data
+		return 0, &SyntaxError{Offset: start, Tag: tag, Err: ErrInvalidLength}
+	} else if (b & 0x80) == 0 {
+		return int(b), nil
+	}
+
+	lenBytes := int(b & 0x7F)
+	if lenBytes > limit(d.MaxLengthBytes, DefaultMaxLengthBytes) {
+		return 0, &SyntaxError{Offset: start, Tag: tag, Err: ErrLengthOverflow}
+	}
+
+	length := 0
+	for range lenBytes {
+		b, err = d.r.ReadByte()
+		if err == io.EOF {
+			return 0, &SyntaxError{Offset: start, Tag: tag, Err: ErrTruncatedLength}
+		} else if err != nil {
+			return 0, err
+		}
+		d.offset++
+
+		if length > math.MaxInt>>8 {
+			return 0, &SyntaxError{Offset: start, Tag: tag, Err: ErrLengthOverflow}
+		}
+		length = length<<8 | int(b)
+	}
+	return length, nil
+}
+
+// limit returns n, or def when n is zero
+func limit(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
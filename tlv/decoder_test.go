@@ -0,0 +1,195 @@
+package tlv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	// Two concatenated responses: a 77 template and a bare 9F27
+	data := mustDecodeHex(t, "770C9F2701809F360200019A01269F270140")
+
+	expected := []struct {
+		tag    uint32
+		value  string
+		offset int64
+	}{
+		{0x77, "9f2701809f360200019a0126", 0},
+		{0x9F27, "40", 14},
+	}
+
+	d := NewDecoder(bytes.NewReader(data))
+	for i, want := range expected {
+		token, err := d.Next()
+		if err != nil {
+			t.Fatalf("Token %d: expected no error, got: %v", i, err)
+		}
+		if token.Tag != want.tag || hex.EncodeToString(token.Value) != want.value || token.Offset != want.offset {
+			t.Errorf("Token %d: expected %X=%s at offset %d, got: %X=%X at offset %d",
+				i, want.tag, want.value, want.offset, token.Tag, token.Value, token.Offset)
+		}
+	}
+
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestDecoderDescend(t *testing.T) {
+	// FCI with a nested A5 template, followed by a top-level 9F27
+	data := mustDecodeHex(t, "6F0C8402AABBA5065004564953419F270180")
+
+	expected := []struct {
+		tag    uint32
+		value  string
+		offset int64
+		depth  int
+	}{
+		{0x6F, "", 0, 0},
+		{0x84, "aabb", 2, 1},
+		{0xA5, "", 6, 1},
+		{0x50, "56495341", 8, 2},
+		{0x9F27, "80", 14, 0},
+	}
+
+	d := NewDecoder(bytes.NewReader(data))
+	d.Descend = true
+	for i, want := range expected {
+		token, err := d.Next()
+		if err != nil {
+			t.Fatalf("Token %d: expected no error, got: %v", i, err)
+		}
+		if token.Tag != want.tag || hex.EncodeToString(token.Value) != want.value ||
+			token.Offset != want.offset || token.Depth != want.depth {
+			t.Errorf("Token %d: expected %X=%s at offset %d depth %d, got: %X=%X at offset %d depth %d",
+				i, want.tag, want.value, want.offset, want.depth, token.Tag, token.Value, token.Offset, token.Depth)
+		}
+	}
+
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		descend bool
+		kind    error
+		offset  int64
+	}{
+		{"truncated tag", "9F2701809F", false, ErrTruncatedTag, 4},
+		{"missing length", "9F27", false, ErrTruncatedLength, 2},
+		{"truncated extended length", "9F108201", false, ErrTruncatedLength, 2},
+		{"truncated value", "9F100706011203", false, ErrTruncatedValue, 3},
+		{"indefinite length", "7780", false, ErrInvalidLength, 1},
+		{"tag too long", "DF81828384850100", false, ErrTagTooLong, 0},
+		{"too many length bytes", "9F108400000001", false, ErrLengthOverflow, 2},
+		{"value too long", "9F1083010000", false, ErrValueTooLong, 2},
+		{"child longer than template", "77039F2705", true, ErrTruncatedValue, 5},
+		{"truncated template", "77059F270180", true, ErrTruncatedValue, 6},
+	}
+
+	for _, tt := range tests {
+		d := NewDecoder(bytes.NewReader(mustDecodeHex(t, tt.data)))
+		d.Descend = tt.descend
+
+		var err error
+		for err == nil {
+			_, err = d.Next()
+		}
+
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, err)
+			continue
+		}
+		if syntaxErr.Offset != tt.offset {
+			t.Errorf("%s: expected offset %d, got: %d", tt.name, tt.offset, syntaxErr.Offset)
+		}
+	}
+}
+
+func TestDecoderDepthLimit(t *testing.T) {
+	d := NewDecoder(bytes.NewReader(mustDecodeHex(t, "6F04A5027000")))
+	d.Descend = true
+	d.MaxDepth = 2
+
+	var err error
+	for err == nil {
+		_, err = d.Next()
+	}
+	if !errors.Is(err, ErrDepthLimit) {
+		t.Errorf("Expected %v, got: %v", ErrDepthLimit, err)
+	}
+}
+
+// repeatReader yields the same bytes forever
+type repeatReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.data[r.pos]
+		r.pos = (r.pos + 1) % len(r.data)
+	}
+	return len(p), nil
+}
+
+func TestDecoderBoundedMemory(t *testing.T) {
+	// An endless stream of records, with values of 1 to 200 bytes
+	var record []byte
+	for _, n := range []int{1, 200, 16} {
+		record = append(record, 0x9F, 0x10, 0x81, byte(n))
+		record = append(record, bytes.Repeat([]byte{0xAA}, n)...)
+	}
+
+	d := NewDecoder(&repeatReader{data: record})
+	for i := range 100000 {
+		token, err := d.Next()
+		if err != nil {
+			t.Fatalf("Token %d: expected no error, got: %v", i, err)
+		}
+		if token.Tag != 0x9F10 {
+			t.Fatalf("Token %d: expected tag 9F10, got: %X", i, token.Tag)
+		}
+	}
+
+	if cap(d.buf) > 200 {
+		t.Errorf("Expected the value buffer to stay at 200 bytes, got: %d", cap(d.buf))
+	}
+}
+
+func TestFormatTag(t *testing.T) {
+	tests := map[uint32]string{
+		0x5A:     "5A",
+		0x9F26:   "9F26",
+		0xDF8129: "DF8129",
+		0x0F:     "0F",
+	}
+	for tag, want := range tests {
+		if got := FormatTag(tag); got != want {
+			t.Errorf("Expected %s, got: %s", want, got)
+		}
+	}
+
+	if !Constructed(0xBF0C) || !Constructed(0x77) || Constructed(0x9F26) || Constructed(0xDF8129) {
+		t.Errorf("Expected only BF0C and 77 to be constructed")
+	}
+}
+
+// Helper to decode hex test data
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Error decoding hex: %v", err)
+	}
+	return b
+}
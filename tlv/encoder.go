@@ -0,0 +1,115 @@
+package tlv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encoder writes BER-TLV data objects to an io.Writer. Data objects inside
+// constructed templates opened with Begin are buffered until the matching
+// End, when the template length is known; everything else is written
+// directly.
+type Encoder struct {
+	w io.Writer
+
+	// buf holds the open templates, which start at the offsets in starts
+	buf    []byte
+	starts []int
+	tags   []uint32
+}
+
+// NewEncoder returns an Encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes a data object with tag and value
+func (e *Encoder) Encode(tag uint32, value []byte) error {
+	if len(e.starts) > 0 {
+		e.buf = Append(e.buf, tag, value)
+		return nil
+	}
+
+	e.buf = Append(e.buf[:0], tag, value)
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// Begin opens a constructed template with tag. The data objects encoded
+// until the matching End become its value.
+func (e *Encoder) Begin(tag uint32) error {
+	if !Constructed(tag) {
+		return fmt.Errorf("tag %s is not a constructed tag", FormatTag(tag))
+	}
+	if len(e.starts) == 0 {
+		e.buf = e.buf[:0]
+	}
+	e.starts = append(e.starts, len(e.buf))
+	e.tags = append(e.tags, tag)
+	return nil
+}
+
+// End closes the template opened by the last Begin, writing it once the
+// outermost template is closed
+func (e *Encoder) End() error {
+	n := len(e.starts)
+	if n == 0 {
+		return errors.New("end without an open template")
+	}
+
+	e.buf = Wrap(e.buf, e.starts[n-1], e.tags[n-1])
+	e.starts, e.tags = e.starts[:n-1], e.tags[:n-1]
+	if n > 1 {
+		return nil
+	}
+
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// Append appends the encoding of a data object with tag and value to dst
+func Append(dst []byte, tag uint32, value []byte) []byte {
+	dst = AppendTag(dst, tag)
+	dst = AppendLength(dst, len(value))
+	return append(dst, value...)
+}
+
+// AppendTag appends the bytes of tag to dst
+func AppendTag(dst []byte, tag uint32) []byte {
+	for i := TagSize(tag) - 1; i >= 0; i-- {
+		dst = append(dst, byte(tag>>(uint(i)*8)))
+	}
+	return dst
+}
+
+// AppendLength appends the shortest definite-form encoding of length to dst
+func AppendLength(dst []byte, length int) []byte {
+	if length < 128 {
+		return append(dst, byte(length))
+	}
+
+	lenBytes := 0
+	for n := length; n > 0; n >>= 8 {
+		lenBytes++
+	}
+
+	dst = append(dst, byte(0x80|lenBytes))
+	for i := lenBytes - 1; i >= 0; i-- {
+		dst = append(dst, byte(length>>(uint(i)*8)))
+	}
+	return dst
+}
+
+// Wrap turns dst[start:] into the value of a data object with tag by inserting
+// its tag and length in front. It builds a template in place after its
+// children have been appended to dst.
+func Wrap(dst []byte, start int, tag uint32) []byte {
+	var header [16]byte
+	h := AppendLength(AppendTag(header[:0], tag), len(dst)-start)
+
+	dst = append(dst, h...)
+	copy(dst[start+len(h):], dst[start:len(dst)-len(h)])
+	copy(dst[start:], h)
+	return dst
+}
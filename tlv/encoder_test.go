@@ -0,0 +1,110 @@
+package tlv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+
+	// PPSE response with nested templates, followed by a primitive
+	steps := []func() error{
+		func() error { return e.Begin(0x6F) },
+		func() error { return e.Encode(0x84, []byte("2PAY.SYS.DDF01")) },
+		func() error { return e.Begin(0xA5) },
+		func() error { return e.Begin(0xBF0C) },
+		func() error { return e.Begin(0x61) },
+		func() error { return e.Encode(0x4F, mustDecodeHex(t, "A0000000031010")) },
+		func() error { return e.Encode(0x50, []byte("VISA CREDIT")) },
+		func() error { return e.Encode(0x87, []byte{0x01}) },
+		func() error { return e.End() },
+		func() error { return e.End() },
+		func() error { return e.End() },
+		func() error { return e.End() },
+		func() error { return e.Encode(0x9F27, []byte{0x80}) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Step %d: expected no error, got: %v", i, err)
+		}
+	}
+
+	expected := "6F30840E325041592E5359532E4444463031A51EBF0C1B61194F07A0000000031010500B56495341204352454449548701019F270180"
+	if got := strings.ToUpper(hex.EncodeToString(buf.Bytes())); got != expected {
+		t.Errorf("Expected %s, got: %s", expected, got)
+	}
+}
+
+func TestEncoderLongLength(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+
+	if err := e.Begin(0x70); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := e.Encode(0x9F4B, bytes.Repeat([]byte{0xAA}, 200)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := e.End(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// 70 81 CC, then 9F4B 81 C8 and 200 value bytes
+	got := buf.Bytes()
+	if len(got) != 3+4+200 || !bytes.Equal(got[:7], []byte{0x70, 0x81, 0xCC, 0x9F, 0x4B, 0x81, 0xC8}) {
+		t.Errorf("Expected header 7081CC9F4B81C8 and 207 bytes, got: %X and %d bytes", got[:7], len(got))
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	e := NewEncoder(&bytes.Buffer{})
+	if err := e.Begin(0x9F26); err == nil {
+		t.Errorf("Expected an error for a primitive template tag")
+	}
+	if err := e.End(); err == nil {
+		t.Errorf("Expected an error for End without Begin")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	tests := []struct {
+		tag      uint32
+		length   int
+		expected string
+	}{
+		{0x5A, 8, "5A08"},
+		{0x9F10, 127, "9F107F"},
+		{0x9F10, 128, "9F108180"},
+		{0xDF8129, 256, "DF8129820100"},
+	}
+
+	for _, tt := range tests {
+		got := Append(nil, tt.tag, make([]byte, tt.length))
+		header := strings.ToUpper(hex.EncodeToString(got[:len(got)-tt.length]))
+		if header != tt.expected {
+			t.Errorf("Expected header %s, got: %s", tt.expected, header)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	dst := []byte{0x01}
+	dst = Append(dst, 0x9F27, []byte{0x80})
+	dst = Wrap(dst, 1, 0x77)
+
+	if hex.EncodeToString(dst) != "0177049f270180" {
+		t.Errorf("Expected 0177049F270180, got: %X", dst)
+	}
+
+	// The round trip through the Decoder gives back the data objects
+	d := NewDecoder(bytes.NewReader(dst[1:]))
+	d.Descend = true
+	token, err := d.Next()
+	if err != nil || token.Tag != 0x77 || token.Length != 4 {
+		t.Errorf("Expected template 77 of length 4, got: %X of length %d (%v)", token.Tag, token.Length, err)
+	}
+}
@@ -0,0 +1,194 @@
+package tlv
+
+import "math"
+
+// Iterator walks the data objects of a BER-TLV buffer in place, like
+// bufio.Scanner. It does not allocate: values and headers are slices of the
+// buffer. It does not descend into constructed values; start another
+// Iterator on Value to do so.
+//
+//	it := tlv.NewIterator(de55)
+//	for it.Next() {
+//		switch it.Tag() {
+//		case 0x9F26:
+//			cryptogram = it.Value()
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	// MaxValueLength is the longest value accepted. Zero selects
+	// DefaultMaxValueLength.
+	MaxValueLength int
+
+	// MaxLengthBytes is the maximum number of bytes following 81-FF in the
+	// long form of a length. Zero selects DefaultMaxLengthBytes.
+	MaxLengthBytes int
+
+	data []byte
+	pos  int
+	err  error
+
+	// The current data object
+	tag    uint32
+	offset int
+	header []byte
+	value  []byte
+}
+
+// NewIterator returns an Iterator over the data objects in data
+func NewIterator(data []byte) *Iterator {
+	return &Iterator{data: data}
+}
+
+// Next advances to the next data object, returning false at the end of the
+// data or on malformed data. Err tells the two apart.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.pos >= len(it.data) {
+		return false
+	}
+
+	start := it.pos
+	tag, pos, err := it.readTag(start)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	lengthOffset := pos
+	length, pos, err := it.readLength(tag, pos)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	if length > limit(it.MaxValueLength, DefaultMaxValueLength) {
+		it.err = &SyntaxError{Offset: int64(lengthOffset), Tag: tag, Err: ErrValueTooLong}
+		return false
+	}
+	if length > len(it.data)-pos {
+		it.err = &SyntaxError{Offset: int64(pos), Tag: tag, Err: ErrTruncatedValue}
+		return false
+	}
+
+	it.tag = tag
+	it.offset = start
+	it.header = it.data[start:pos]
+	it.value = it.data[pos : pos+length]
+	it.pos = pos + length
+	return true
+}
+
+// Tag returns the tag of the current data object
+func (it *Iterator) Tag() uint32 {
+	return it.tag
+}
+
+// Value returns the value of the current data object
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Header returns the tag and length bytes of the current data object exactly
+// as they appear in the data
+func (it *Iterator) Header() []byte {
+	return it.header
+}
+
+// Offset returns the byte offset of the tag of the current data object
+func (it *Iterator) Offset() int {
+	return it.offset
+}
+
+// Pos returns the byte offset at which Next continues
+func (it *Iterator) Pos() int {
+	return it.pos
+}
+
+// Err returns the first *SyntaxError found, or nil if the data was read to
+// the end
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// SkipPadding skips the 00 and FF padding bytes that EMV Book 3 allows
+// before, between and after data objects, returning how many were skipped.
+// Since FF also starts tags such as FF8105, it only counts as padding when it
+// is followed by more padding or ends the data.
+func (it *Iterator) SkipPadding() int {
+	start := it.pos
+	for it.pos < len(it.data) {
+		c := it.data[it.pos]
+		last := it.pos+1 == len(it.data)
+		if c == 0x00 || (c == 0xFF && (last || it.data[it.pos+1] == 0x00 || it.data[it.pos+1] == 0xFF)) {
+			it.pos++
+			continue
+		}
+		break
+	}
+	return it.pos - start
+}
+
+// readTag reads the tag starting at data[pos]
+func (it *Iterator) readTag(pos int) (uint32, int, error) {
+	start := pos
+	b := it.data[pos]
+	pos++
+
+	tag := uint32(b)
+	if (b & 0x1F) != 0x1F {
+		return tag, pos, nil
+	}
+
+	// Subsequent bytes have b8 set when another byte follows
+	for size := 2; ; size++ {
+		if pos >= len(it.data) {
+			return 0, 0, &SyntaxError{Offset: int64(start), Err: ErrTruncatedTag}
+		}
+		if size > 4 {
+			return 0, 0, &SyntaxError{Offset: int64(start), Err: ErrTagTooLong}
+		}
+		b = it.data[pos]
+		pos++
+
+		tag = tag<<8 | uint32(b)
+		if (b & 0x80) == 0 {
+			return tag, pos, nil
+		}
+	}
+}
+
+// readLength reads the definite-form length starting at data[pos]
+func (it *Iterator) readLength(tag uint32, pos int) (int, int, error) {
+	start := pos
+	if pos >= len(it.data) {
+		return 0, 0, &SyntaxError{Offset: int64(start), Tag: tag, Err: ErrTruncatedLength}
+	}
+	b := it.data[pos]
+	pos++
+
+	if b == 0x80 {
+		// The indefinite form is not allowed in EMV data
+		return 0, 0, &SyntaxError{Offset: int64(start), Tag: tag, Err: ErrInvalidLength}
+	} else if (b & 0x80) == 0 {
+		return int(b), pos, nil
+	}
+
+	lenBytes := int(b & 0x7F)
+	if lenBytes > limit(it.MaxLengthBytes, DefaultMaxLengthBytes) {
+		return 0, 0, &SyntaxError{Offset: int64(start), Tag: tag, Err: ErrLengthOverflow}
+	}
+	if lenBytes > len(it.data)-pos {
+		return 0, 0, &SyntaxError{Offset: int64(start), Tag: tag, Err: ErrTruncatedLength}
+	}
+
+	length := 0
+	for _, c := range it.data[pos : pos+lenBytes] {
+		if length > math.MaxInt>>8 {
+			return 0, 0, &SyntaxError{Offset: int64(start), Tag: tag, Err: ErrLengthOverflow}
+		}
+		length = length<<8 | int(c)
+	}
+	return length, pos + lenBytes, nil
+}
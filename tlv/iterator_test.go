@@ -0,0 +1,197 @@
+package tlv
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	// A 77 template, a bare 9F27 and a value with a two-byte length
+	data := mustDecodeHex(t, "770C9F2701809F360200019A01269F2701409F108181"+strings.Repeat("AA", 0x81))
+
+	expected := []struct {
+		tag    uint32
+		header string
+		offset int
+		length int
+	}{
+		{0x77, "770c", 0, 12},
+		{0x9F27, "9f2701", 14, 1},
+		{0x9F10, "9f108181", 18, 0x81},
+	}
+
+	it := NewIterator(data)
+	for i, want := range expected {
+		if !it.Next() {
+			t.Fatalf("Data object %d: expected Next to succeed, got: %v", i, it.Err())
+		}
+		if it.Tag() != want.tag || hex.EncodeToString(it.Header()) != want.header || it.Offset() != want.offset || len(it.Value()) != want.length {
+			t.Errorf("Data object %d: expected %X (%s) of %d bytes at offset %d, got: %X (%x) of %d bytes at offset %d",
+				i, want.tag, want.header, want.length, want.offset, it.Tag(), it.Header(), len(it.Value()), it.Offset())
+		}
+	}
+
+	if it.Next() {
+		t.Errorf("Expected the end of the data, got: %X", it.Tag())
+	}
+	if it.Err() != nil {
+		t.Errorf("Expected no error, got: %v", it.Err())
+	}
+}
+
+func TestIteratorNested(t *testing.T) {
+	// Values are slices of the input, so templates are read in place
+	data := mustDecodeHex(t, "6F0C8402AABBA5065004564953419F270180")
+
+	it := NewIterator(data)
+	if !it.Next() || it.Tag() != 0x6F || !Constructed(it.Tag()) {
+		t.Fatalf("Expected template 6F, got: %X (%v)", it.Tag(), it.Err())
+	}
+
+	var tags []uint32
+	inner := NewIterator(it.Value())
+	for inner.Next() {
+		tags = append(tags, inner.Tag())
+	}
+	if inner.Err() != nil || len(tags) != 2 || tags[0] != 0x84 || tags[1] != 0xA5 {
+		t.Errorf("Expected 84 and A5 inside 6F, got: %X (%v)", tags, inner.Err())
+	}
+
+	if !it.Next() || it.Tag() != 0x9F27 {
+		t.Errorf("Expected 9F27 after the template, got: %X (%v)", it.Tag(), it.Err())
+	}
+}
+
+func TestIteratorTagSize(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected int
+	}{
+		{"9F10", 2},
+		{"82", 1},
+		{"DF8129", 3},
+		{"FF8105", 3},
+		{"5F20", 2},
+		{"DF818101", 4},
+	}
+
+	for _, tt := range tests {
+		// The tag followed by an empty value
+		it := NewIterator(mustDecodeHex(t, tt.tag+"00"))
+		if !it.Next() {
+			t.Fatalf("Error reading tag %s: %v", tt.tag, it.Err())
+		}
+		if FormatTag(it.Tag()) != tt.tag || TagSize(it.Tag()) != tt.expected || len(it.Header()) != tt.expected+1 {
+			t.Errorf("Expected tag %s of %d bytes, got: %s of %d bytes", tt.tag, tt.expected, FormatTag(it.Tag()), TagSize(it.Tag()))
+		}
+	}
+
+	// A subsequent byte with b8 set must be followed by another byte
+	it := NewIterator(mustDecodeHex(t, "DF81"))
+	if it.Next() || !errors.Is(it.Err(), ErrTruncatedTag) {
+		t.Errorf("Expected %v for truncated tag DF81, got: %v", ErrTruncatedTag, it.Err())
+	}
+}
+
+func TestIteratorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		kind   error
+		offset int64
+	}{
+		{"truncated tag", "9F2701809F", ErrTruncatedTag, 4},
+		{"missing length", "9F27", ErrTruncatedLength, 2},
+		{"truncated extended length", "9F108201", ErrTruncatedLength, 2},
+		{"truncated value", "9F100706011203", ErrTruncatedValue, 3},
+		{"indefinite length", "7780", ErrInvalidLength, 1},
+		{"tag too long", "DF81828384850100", ErrTagTooLong, 0},
+		{"too many length bytes", "9F108400000001", ErrLengthOverflow, 2},
+		{"value too long", "9F1083010000", ErrValueTooLong, 2},
+	}
+
+	for _, tt := range tests {
+		it := NewIterator(mustDecodeHex(t, tt.data))
+		for it.Next() {
+		}
+
+		var syntaxErr *SyntaxError
+		if !errors.As(it.Err(), &syntaxErr) || !errors.Is(it.Err(), tt.kind) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, it.Err())
+			continue
+		}
+		if syntaxErr.Offset != tt.offset {
+			t.Errorf("%s: expected offset %d, got: %d", tt.name, tt.offset, syntaxErr.Offset)
+		}
+		if it.Next() {
+			t.Errorf("%s: expected Next to keep failing after an error", tt.name)
+		}
+	}
+}
+
+func TestIteratorSkipPadding(t *testing.T) {
+	// Leading 00 padding, FF8105 which is a tag and not padding, and
+	// trailing FF padding
+	it := NewIterator(mustDecodeHex(t, "0000FF8105009F270180FFFF"))
+
+	var tags []uint32
+	var padding int
+	for {
+		padding += it.SkipPadding()
+		if !it.Next() {
+			break
+		}
+		tags = append(tags, it.Tag())
+	}
+
+	if it.Err() != nil {
+		t.Fatalf("Expected no error, got: %v", it.Err())
+	}
+	if len(tags) != 2 || tags[0] != 0xFF8105 || tags[1] != 0x9F27 {
+		t.Errorf("Expected FF8105 and 9F27, got: %X", tags)
+	}
+	if padding != 4 {
+		t.Errorf("Expected 4 padding bytes, got: %d", padding)
+	}
+}
+
+func TestIteratorDoesNotAllocate(t *testing.T) {
+	data := mustDecodeHex(t, benchmarkData)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		it := NewIterator(data)
+		for it.Next() {
+			if Constructed(it.Tag()) {
+				inner := NewIterator(it.Value())
+				for inner.Next() {
+				}
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got: %v", allocs)
+	}
+}
+
+// DE55 with a 77 template, used by the benchmarks
+const benchmarkData = "9F2608D0C669EEB70C58DD9F2701809F100706011203A000009F3704123456789F36020069" +
+	"770A950500000080009C01009F02060000000010005F2A020840820220009F1A020840"
+
+func BenchmarkIterator(b *testing.B) {
+	data, err := hex.DecodeString(benchmarkData)
+	if err != nil {
+		b.Fatalf("Error decoding hex: %v", err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		it := NewIterator(data)
+		for it.Next() {
+		}
+		if it.Err() != nil {
+			b.Fatalf("Error iterating: %v", it.Err())
+		}
+	}
+}
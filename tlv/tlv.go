@@ -0,0 +1,102 @@
+// Package tlv reads and writes the BER-TLV encoding used by EMV data, one
+// data object at a time.
+//
+// Tags are handled as uint32 values holding the tag bytes big-endian, so tag
+// 9F26 is 0x9F26. EMV tags are at most three bytes long; tags of up to four
+// bytes are accepted.
+package tlv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of malformed TLV data. Use errors.Is to test for them.
+var (
+	// ErrTruncatedTag means the data ended inside a tag
+	ErrTruncatedTag = errors.New("unexpected end of data when reading tag")
+
+	// ErrTruncatedLength means the data ended inside a length
+	ErrTruncatedLength = errors.New("unexpected end of data when reading length")
+
+	// ErrTruncatedValue means the data ended before the value was complete
+	ErrTruncatedValue = errors.New("unexpected end of data when reading value")
+
+	// ErrInvalidLength means the length is not a valid definite-form length
+	ErrInvalidLength = errors.New("invalid length")
+
+	// ErrTagTooLong means a tag has more than four bytes
+	ErrTagTooLong = errors.New("tag longer than 4 bytes")
+
+	// ErrDepthLimit means constructed values are nested too deeply
+	ErrDepthLimit = errors.New("maximum nesting depth exceeded")
+
+	// ErrValueTooLong means a length exceeds the maximum value length
+	ErrValueTooLong = errors.New("value exceeds maximum length")
+
+	// ErrLengthOverflow means a length uses too many bytes or does not fit
+	// in an int
+	ErrLengthOverflow = errors.New("length overflows")
+)
+
+// Default limits, used when the matching Decoder field is zero
+const (
+	DefaultMaxDepth       = 16
+	DefaultMaxValueLength = 65535
+	DefaultMaxLengthBytes = 3
+)
+
+// SyntaxError describes malformed TLV data read by a Decoder
+type SyntaxError struct {
+	// Offset is the byte offset in the input of the tag, length or value
+	// that could not be read
+	Offset int64
+
+	// Tag is the tag of the data object being read, zero if the tag itself
+	// could not be read
+	Tag uint32
+
+	// Err is the kind of error, such as ErrTruncatedValue
+	Err error
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Tag != 0 {
+		return fmt.Sprintf("%v at offset %d (tag %s)", e.Err, e.Offset, FormatTag(e.Tag))
+	}
+	return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+}
+
+// Unwrap returns the kind of error, so errors.Is works with the sentinel errors
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Constructed reports whether tag is a constructed tag, whose value holds
+// further data objects. It is b6 of the first tag byte.
+func Constructed(tag uint32) bool {
+	return tagByte(tag)&0x20 != 0
+}
+
+// FormatTag returns tag as an uppercase hex string, e.g. "9F26"
+func FormatTag(tag uint32) string {
+	return fmt.Sprintf("%0*X", TagSize(tag)*2, tag)
+}
+
+// TagSize returns the number of bytes in tag
+func TagSize(tag uint32) int {
+	switch {
+	case tag > 0xFFFFFF:
+		return 4
+	case tag > 0xFFFF:
+		return 3
+	case tag > 0xFF:
+		return 2
+	}
+	return 1
+}
+
+// tagByte returns the first byte of tag
+func tagByte(tag uint32) byte {
+	return byte(tag >> (uint(TagSize(tag)-1) * 8))
+}
@@ -0,0 +1,319 @@
+package emvparser
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeTree(t *testing.T) {
+	// PPSE response with two application entries (61) under BF0C
+	data, err := hex.DecodeString("6F31840E325041592E5359532E4444463031A51FBF0C1C610C4F07A0000000031010870101610C4F07A0000000032010870102")
+	if err != nil {
+		t.Fatalf("Error decoding hex: %v", err)
+	}
+
+	nodes, err := DecodeTree(data)
+	if err != nil {
+		t.Fatalf("Error decoding TLV tree: %v", err)
+	}
+
+	if len(nodes) != 1 || nodes[0].Tag != "6F" {
+		t.Fatalf("Expected a single 6F node, got: %d nodes", len(nodes))
+	}
+
+	fci := nodes[0]
+	if !fci.Constructed() || len(fci.Children) != 2 {
+		t.Fatalf("Expected 6F to be constructed with 2 children, got: %d", len(fci.Children))
+	}
+	if fci.Children[0].Tag != "84" || fci.Children[1].Tag != "A5" {
+		t.Errorf("Expected children 84 and A5, got: %s and %s", fci.Children[0].Tag, fci.Children[1].Tag)
+	}
+
+	bf0c := fci.Children[1].Children[0]
+	if bf0c.Tag != "BF0C" || len(bf0c.Children) != 2 {
+		t.Fatalf("Expected BF0C with 2 application entries, got: %s with %d", bf0c.Tag, len(bf0c.Children))
+	}
+
+	// Duplicate 61 entries must both be kept, in input order
+	expected := []struct {
+		offset int
+		aid    string
+		aidOff int
+	}{
+		{23, "A0000000031010", 25},
+		{37, "A0000000032010", 39},
+	}
+	for i, entry := range bf0c.Children {
+		if entry.Tag != "61" || entry.Offset != expected[i].offset {
+			t.Errorf("Entry %d: expected 61 at offset %d, got: %s at %d", i, expected[i].offset, entry.Tag, entry.Offset)
+		}
+		aid := entry.Children[0]
+		if aid.Tag != "4F" || !bytesEqual(aid.Value, mustDecodeHex(t, expected[i].aid)) {
+			t.Errorf("Entry %d: expected AID %s, got: %X", i, expected[i].aid, aid.Value)
+		}
+		if aid.Offset != expected[i].aidOff || aid.Length != 7 {
+			t.Errorf("Entry %d: expected AID at offset %d with length 7, got: %d with %d", i, expected[i].aidOff, aid.Offset, aid.Length)
+		}
+	}
+}
+
+func TestDecodeTreeTruncated(t *testing.T) {
+	data, _ := hex.DecodeString("9F100706011203")
+	if _, err := DecodeTree(data); err == nil {
+		t.Errorf("Expected an error for a truncated value")
+	}
+}
+
+func TestDecodeTreeStrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		kind   error
+		offset int
+	}{
+		{"padding between objects", "9F27018000009F36020001", ErrPadding, 4},
+		{"trailing padding", "9F270180FFFF", ErrPadding, 4},
+		{"non-minimal length", "9F27810180", ErrNonMinimalLength, 2},
+		{"leading zero length byte", "9F2782000180", ErrNonMinimalLength, 2},
+	}
+
+	for _, tt := range tests {
+		_, _, err := ParseOptions{Mode: ParseStrict}.DecodeTree(mustDecodeHex(t, tt.data))
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, err)
+			continue
+		}
+		if parseErr.Offset != tt.offset {
+			t.Errorf("%s: expected offset %d, got: %d", tt.name, tt.offset, parseErr.Offset)
+		}
+	}
+
+	// Well-formed data is accepted
+	if _, _, err := (ParseOptions{Mode: ParseStrict}).DecodeTree(mustDecodeHex(t, "77099F2701809F36020001")); err != nil {
+		t.Errorf("Expected no error for well-formed data, got: %v", err)
+	}
+}
+
+func TestDecodeTreeLenient(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		tags     []string
+		warnings []error
+		offsets  []int
+	}{
+		{
+			"padding",
+			"009F27018000009F360200010000FF",
+			[]string{"9F27", "9F36"},
+			[]error{ErrPadding, ErrPadding, ErrPadding},
+			[]int{0, 5, 12},
+		},
+		{
+			"non-minimal length",
+			"9F27810180",
+			[]string{"9F27"},
+			[]error{ErrNonMinimalLength},
+			[]int{2},
+		},
+		{
+			"trailing garbage",
+			"9F2701809F100706011203",
+			[]string{"9F27"},
+			[]error{ErrTruncatedValue},
+			[]int{7},
+		},
+		{
+			"truncated inside a template",
+			"77099F2701809F360300019A03261016",
+			[]string{"77", "9A"},
+			[]error{ErrTruncatedValue},
+			[]int{9},
+		},
+	}
+
+	for _, tt := range tests {
+		nodes, warnings, err := ParseOptions{Mode: ParseLenient}.DecodeTree(mustDecodeHex(t, tt.data))
+		if err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.name, err)
+			continue
+		}
+
+		if len(nodes) != len(tt.tags) {
+			t.Errorf("%s: expected %d nodes, got: %d", tt.name, len(tt.tags), len(nodes))
+			continue
+		}
+		for i, node := range nodes {
+			if node.Tag != tt.tags[i] {
+				t.Errorf("%s: expected node %d to be %s, got: %s", tt.name, i, tt.tags[i], node.Tag)
+			}
+		}
+
+		if len(warnings) != len(tt.warnings) {
+			t.Errorf("%s: expected %d warnings, got: %v", tt.name, len(tt.warnings), warnings)
+			continue
+		}
+		for i, w := range warnings {
+			if !errors.Is(w, tt.warnings[i]) || w.Offset != tt.offsets[i] {
+				t.Errorf("%s: expected warning %v at offset %d, got: %v", tt.name, tt.warnings[i], tt.offsets[i], w)
+			}
+		}
+	}
+}
+
+func TestDecodeTreeDefaultMode(t *testing.T) {
+	// Non-minimal lengths are accepted without warnings
+	nodes, warnings, err := ParseOptions{}.DecodeTree(mustDecodeHex(t, "9F27810180"))
+	if err != nil || len(nodes) != 1 || len(warnings) != 0 {
+		t.Errorf("Expected one node and no warnings, got: %d nodes, %v, %v", len(nodes), warnings, err)
+	}
+
+	// Truncated data is still an error
+	if _, _, err := (ParseOptions{}).DecodeTree(mustDecodeHex(t, "9F2701809F100706011203")); !errors.Is(err, ErrTruncatedValue) {
+		t.Errorf("Expected %v, got: %v", ErrTruncatedValue, err)
+	}
+}
+
+func TestParseLenientWarnings(t *testing.T) {
+	parser := NewEMVParser(WithParseOptions(ParseOptions{Mode: ParseLenient}))
+	data, err := parser.Parse(mustDecodeHex(t, "9F2701809F3602000100009F10"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !bytesEqual(data.CryptogramInformationData, []byte{0x80}) || !bytesEqual(data.ApplicationTransactionCounter, []byte{0x00, 0x01}) {
+		t.Errorf("Expected 9F27 and 9F36 to be decoded, got: %X and %X", data.CryptogramInformationData, data.ApplicationTransactionCounter)
+	}
+
+	if len(data.Warnings) != 2 || !errors.Is(data.Warnings[0], ErrPadding) || !errors.Is(data.Warnings[1], ErrTruncatedLength) {
+		t.Errorf("Expected padding and truncated length warnings, got: %v", data.Warnings)
+	}
+
+	// The default parser rejects the same data
+	if _, err := NewEMVParser().Parse(mustDecodeHex(t, "9F2701809F3602000100009F10")); err == nil {
+		t.Errorf("Expected an error from the default parser")
+	}
+}
+
+func TestDecodeTreeLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   ParseOptions
+		data   string
+		kind   error
+		offset int
+	}{
+		{"nesting depth", ParseOptions{MaxDepth: 2}, "6F04A5027000", ErrDepthLimit, 4},
+		{"data object count", ParseOptions{MaxTLVs: 2}, "9F2701809F360200019A03261016", ErrTLVLimit, 9},
+		{"value length", ParseOptions{MaxValueLength: 4}, "9F100706011203A0B800", ErrValueTooLong, 2},
+		{"default value length", ParseOptions{}, "9F1083FFFFFF", ErrValueTooLong, 2},
+		{"length bytes", ParseOptions{}, "9F108400000001AA", ErrLengthOverflow, 2},
+		{"int overflow", ParseOptions{MaxLengthBytes: 127}, "9F1089FFFFFFFFFFFFFFFFFF", ErrLengthOverflow, 2},
+		{"limits apply in lenient mode", ParseOptions{Mode: ParseLenient, MaxDepth: 1}, "77039F2700", ErrDepthLimit, 2},
+	}
+
+	for _, tt := range tests {
+		_, _, err := tt.opts.DecodeTree(mustDecodeHex(t, tt.data))
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, err)
+			continue
+		}
+		if parseErr.Offset != tt.offset {
+			t.Errorf("%s: expected offset %d, got: %d", tt.name, tt.offset, parseErr.Offset)
+		}
+	}
+
+	// Data within the limits decodes normally
+	opts := ParseOptions{MaxDepth: 3, MaxTLVs: 3, MaxValueLength: 4}
+	if _, _, err := opts.DecodeTree(mustDecodeHex(t, "6F04A5027000")); err != nil {
+		t.Errorf("Expected no error within the limits, got: %v", err)
+	}
+}
+
+// Helper to decode hex test data
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Error decoding hex: %v", err)
+	}
+	return b
+}
+
+func TestMarshalRaw(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		mode       ParseMode
+		normalised string
+	}{
+		{"non-minimal lengths", "77810A9F278101809F36020001", ParseDefault, "77099F2701809F36020001"},
+		{"padding", "00009F27018000009F36020001FFFF", ParseLenient, "9F2701809F36020001"},
+		{"padding in default mode", "9F2701800000", ParseDefault, "9F270180"},
+		{"truncated value", "9F2701809F360200", ParseLenient, "9F270180"},
+		{"truncated value inside a template", "77089F2701809F360200", ParseLenient, "77049F270180"},
+		{"padding inside a template", "770B9F27018000009F36020001", ParseLenient, "77099F2701809F36020001"},
+	}
+
+	for _, tt := range tests {
+		nodes, _, err := ParseOptions{Mode: tt.mode}.DecodeTree(mustDecodeHex(t, tt.data))
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", tt.name, err)
+		}
+
+		if raw := hex.EncodeToString(nodes.MarshalRaw()); !strings.EqualFold(raw, tt.data) {
+			t.Errorf("%s: expected MarshalRaw to return %s, got: %s", tt.name, tt.data, raw)
+		}
+		if normalised := hex.EncodeToString(nodes.Marshal()); !strings.EqualFold(normalised, tt.normalised) {
+			t.Errorf("%s: expected Marshal to return %s, got: %s", tt.name, tt.normalised, normalised)
+		}
+	}
+}
+
+func TestMarshalRawEditedNodes(t *testing.T) {
+	data := mustDecodeHex(t, "77810A9F278101809F36020001")
+
+	tests := []struct {
+		name     string
+		edit     func(TLVList)
+		expected string
+	}{
+		{
+			// The headers still match, so they are kept
+			"same length",
+			func(nodes TLVList) { nodes[0].Children[0].Value = []byte{0x40} },
+			"77810A9F278101409F36020001",
+		},
+		{
+			// 9F27 is re-encoded with a minimal length, which leaves the
+			// length of 77 unchanged
+			"longer value",
+			func(nodes TLVList) { nodes[0].Children[0].Value = []byte{0x80, 0x01} },
+			"77810A9F270280019F36020001",
+		},
+		{
+			// 77 grows, so its header is re-encoded
+			"node built by hand",
+			func(nodes TLVList) {
+				nodes[0].Children = append(nodes[0].Children, &TLV{Tag: "9F10", Value: []byte{0x01}})
+			},
+			"770E9F278101809F360200019F100101",
+		},
+	}
+
+	for _, tt := range tests {
+		nodes, err := DecodeTree(data)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", tt.name, err)
+		}
+
+		tt.edit(nodes)
+		if raw := hex.EncodeToString(nodes.MarshalRaw()); !strings.EqualFold(raw, tt.expected) {
+			t.Errorf("%s: expected %s, got: %s", tt.name, tt.expected, raw)
+		}
+	}
+}
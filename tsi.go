@@ -0,0 +1,136 @@
+package emvparser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TSI is the Transaction Status Information (tag 9B): two bytes in which the
+// terminal records the functions performed during the transaction, as
+// defined in EMV Book 3 Annex C6. Only byte 1 is defined; byte 2 is RFU. A
+// TSI shorter than two bytes reads as if it were padded with zeros.
+//
+// In JSON a TSI is an object holding the raw value in hex and one boolean
+// per bit, so the bits can be read without decoding them by hand.
+type TSI []byte
+
+// TSIFlag identifies a single bit of the TSI by its byte index and bit mask
+type TSIFlag uint16
+
+// The bits of the TSI, in the order of EMV Book 3 Annex C6
+const (
+	TSIOfflineDataAuthPerformed        TSIFlag = 0<<8 | 0x80
+	TSICardholderVerificationPerformed TSIFlag = 0<<8 | 0x40
+	TSICardRiskManagementPerformed     TSIFlag = 0<<8 | 0x20
+	TSIIssuerAuthenticationPerformed   TSIFlag = 0<<8 | 0x10
+	TSITerminalRiskManagementPerformed TSIFlag = 0<<8 | 0x08
+	TSIScriptProcessingPerformed       TSIFlag = 0<<8 | 0x04
+)
+
+// tsiFlags lists the defined bits with their Annex C6 meaning, in TSI order
+var tsiFlags = []bitMeaning[TSIFlag]{
+	{TSIOfflineDataAuthPerformed, "Offline data authentication was performed"},
+	{TSICardholderVerificationPerformed, "Cardholder verification was performed"},
+	{TSICardRiskManagementPerformed, "Card risk management was performed"},
+	{TSIIssuerAuthenticationPerformed, "Issuer authentication was performed"},
+	{TSITerminalRiskManagementPerformed, "Terminal risk management was performed"},
+	{TSIScriptProcessingPerformed, "Script processing was performed"},
+}
+
+// NewTSI returns a two-byte TSI with the given bits set, for simulators and
+// tests
+func NewTSI(flags ...TSIFlag) TSI {
+	return make(TSI, 2).With(flags...)
+}
+
+// With sets the given bits in place and returns the TSI, growing it to two
+// bytes if needed
+func (t TSI) With(flags ...TSIFlag) TSI { return withBits(t, 2, flags) }
+
+// Has reports whether the bit flag is set
+func (t TSI) Has(flag TSIFlag) bool { return hasBit(t, flag) }
+
+// Flags returns the defined bits that are set, in TSI order
+func (t TSI) Flags() []TSIFlag { return setBits(t, tsiFlags) }
+
+// String lists the meaning of each bit that is set, separated by semicolons,
+// or returns "No TSI bits set"
+func (t TSI) String() string { return describeBits(t, tsiFlags, "No TSI bits set") }
+
+// Format implements fmt.Formatter, so %x and %X print the raw bytes and %s
+// and %v the meaning of the bits
+func (t TSI) Format(s fmt.State, verb rune) { formatBits(s, verb, t, t.String) }
+
+// String returns the Annex C6 meaning of the bit
+func (flag TSIFlag) String() string { return bitName(tsiFlags, flag) }
+
+// OfflineDataAuthPerformed reports byte 1 bit 8
+func (t TSI) OfflineDataAuthPerformed() bool { return t.Has(TSIOfflineDataAuthPerformed) }
+
+// CardholderVerificationPerformed reports byte 1 bit 7
+func (t TSI) CardholderVerificationPerformed() bool {
+	return t.Has(TSICardholderVerificationPerformed)
+}
+
+// CardRiskManagementPerformed reports byte 1 bit 6
+func (t TSI) CardRiskManagementPerformed() bool { return t.Has(TSICardRiskManagementPerformed) }
+
+// IssuerAuthenticationPerformed reports byte 1 bit 5
+func (t TSI) IssuerAuthenticationPerformed() bool { return t.Has(TSIIssuerAuthenticationPerformed) }
+
+// TerminalRiskManagementPerformed reports byte 1 bit 4
+func (t TSI) TerminalRiskManagementPerformed() bool {
+	return t.Has(TSITerminalRiskManagementPerformed)
+}
+
+// ScriptProcessingPerformed reports byte 1 bit 3
+func (t TSI) ScriptProcessingPerformed() bool { return t.Has(TSIScriptProcessingPerformed) }
+
+// tsiJSON is the JSON form of a TSI
+type tsiJSON struct {
+	Value                           string `json:"value"`
+	OfflineDataAuthPerformed        bool   `json:"offlineDataAuthenticationPerformed"`
+	CardholderVerificationPerformed bool   `json:"cardholderVerificationPerformed"`
+	CardRiskManagementPerformed     bool   `json:"cardRiskManagementPerformed"`
+	IssuerAuthenticationPerformed   bool   `json:"issuerAuthenticationPerformed"`
+	TerminalRiskManagementPerformed bool   `json:"terminalRiskManagementPerformed"`
+	ScriptProcessingPerformed       bool   `json:"scriptProcessingPerformed"`
+}
+
+// MarshalJSON encodes the TSI as its hex value and one boolean per bit. An
+// empty TSI encodes as null.
+func (t TSI) MarshalJSON() ([]byte, error) {
+	if len(t) == 0 {
+		return []byte("null"), nil
+	}
+	return json.Marshal(tsiJSON{
+		Value:                           strings.ToUpper(hex.EncodeToString(t)),
+		OfflineDataAuthPerformed:        t.OfflineDataAuthPerformed(),
+		CardholderVerificationPerformed: t.CardholderVerificationPerformed(),
+		CardRiskManagementPerformed:     t.CardRiskManagementPerformed(),
+		IssuerAuthenticationPerformed:   t.IssuerAuthenticationPerformed(),
+		TerminalRiskManagementPerformed: t.TerminalRiskManagementPerformed(),
+		ScriptProcessingPerformed:       t.ScriptProcessingPerformed(),
+	})
+}
+
+// UnmarshalJSON decodes the output of MarshalJSON, taking the bits from the
+// hex value
+func (t *TSI) UnmarshalJSON(data []byte) error {
+	var v *tsiJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v == nil {
+		*t = nil
+		return nil
+	}
+	value, err := hex.DecodeString(v.Value)
+	if err != nil {
+		return err
+	}
+	*t = value
+	return nil
+}
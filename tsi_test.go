@@ -0,0 +1,87 @@
+package emvparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTSI(t *testing.T) {
+	tsi := TSI(mustDecodeHex(t, "E800"))
+
+	tests := []struct {
+		name     string
+		got      bool
+		expected bool
+	}{
+		{"OfflineDataAuthPerformed", tsi.OfflineDataAuthPerformed(), true},
+		{"CardholderVerificationPerformed", tsi.CardholderVerificationPerformed(), true},
+		{"CardRiskManagementPerformed", tsi.CardRiskManagementPerformed(), true},
+		{"IssuerAuthenticationPerformed", tsi.IssuerAuthenticationPerformed(), false},
+		{"TerminalRiskManagementPerformed", tsi.TerminalRiskManagementPerformed(), true},
+		{"ScriptProcessingPerformed", tsi.ScriptProcessingPerformed(), false},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	expected := "Offline data authentication was performed; Cardholder verification was performed; " +
+		"Card risk management was performed; Terminal risk management was performed"
+	if got := tsi.String(); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+
+	built := NewTSI(TSIOfflineDataAuthPerformed, TSICardholderVerificationPerformed, TSICardRiskManagementPerformed, TSITerminalRiskManagementPerformed)
+	if got := fmt.Sprintf("%X", built); got != "E800" {
+		t.Errorf("Expected E800, got: %s", got)
+	}
+}
+
+func TestParseTSI(t *testing.T) {
+	parsed, err := NewEMVParser().Parse(mustDecodeHex(t, "9B026800"+"9F36020001"+"9F6E0420700000"))
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if !parsed.TransactionStatusInformation.CardholderVerificationPerformed() || parsed.TransactionStatusInformation.OfflineDataAuthPerformed() {
+		t.Errorf("Unexpected TSI bits: %s", parsed.TransactionStatusInformation)
+	}
+
+	out, err := json.Marshal(parsed)
+	if err != nil {
+		t.Fatalf("Error encoding JSON: %v", err)
+	}
+	expected := `"tsi":{"value":"6800","offlineDataAuthenticationPerformed":false,` +
+		`"cardholderVerificationPerformed":true,"cardRiskManagementPerformed":true,"issuerAuthenticationPerformed":false,` +
+		`"terminalRiskManagementPerformed":true,"scriptProcessingPerformed":false}`
+	if !strings.Contains(string(out), expected) {
+		t.Errorf("Expected the JSON to contain %s, got: %s", expected, out)
+	}
+
+	// The Form Factor Indicator is no longer under the TSI's name
+	if !strings.Contains(string(out), `"formFactorIndicator":"IHAAAA=="`) || strings.Contains(string(out), "transactionStatusInformation") {
+		t.Errorf("Expected 9F6E under formFactorIndicator only, got: %s", out)
+	}
+	if fmt.Sprintf("%X", parsed.TransactionStatusInfo) != "20700000" {
+		t.Errorf("Expected the deprecated TransactionStatusInfo to be filled, got: %X", parsed.TransactionStatusInfo)
+	}
+
+	var decoded EMVData
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Error decoding JSON: %v", err)
+	}
+	if got := fmt.Sprintf("%X", decoded.TransactionStatusInformation); got != "6800" {
+		t.Errorf("Expected 6800 after a JSON round trip, got: %s", got)
+	}
+
+	// A missing TSI is null
+	out, err = json.Marshal(EMVData{})
+	if err != nil {
+		t.Fatalf("Error encoding JSON: %v", err)
+	}
+	if !strings.Contains(string(out), `"tsi":null`) {
+		t.Errorf("Expected a null TSI, got: %s", out)
+	}
+}
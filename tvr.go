@@ -0,0 +1,226 @@
+package emvparser
+
+import "fmt"
+
+// TVR is the Terminal Verification Results (tag 95): five bytes in which the
+// terminal records the outcome of each check made during the transaction, as
+// defined in EMV Book 3 Annex C5. A TVR shorter than five bytes reads as if
+// it were padded with zeros.
+type TVR []byte
+
+// TVRFlag identifies a single bit of the TVR. It holds the byte index in its
+// high byte and the bit mask in its low byte.
+type TVRFlag uint16
+
+// The bits of the TVR, in the order of EMV Book 3 Annex C5
+const (
+	// Byte 1
+	TVROfflineDataAuthNotPerformed TVRFlag = 0<<8 | 0x80
+	TVRSDAFailed                   TVRFlag = 0<<8 | 0x40
+	TVRICCDataMissing              TVRFlag = 0<<8 | 0x20
+	TVRCardOnExceptionFile         TVRFlag = 0<<8 | 0x10
+	TVRDDAFailed                   TVRFlag = 0<<8 | 0x08
+	TVRCDAFailed                   TVRFlag = 0<<8 | 0x04
+	TVRSDASelected                 TVRFlag = 0<<8 | 0x02
+
+	// Byte 2
+	TVRDifferentApplicationVersions TVRFlag = 1<<8 | 0x80
+	TVRExpiredApplication           TVRFlag = 1<<8 | 0x40
+	TVRApplicationNotYetEffective   TVRFlag = 1<<8 | 0x20
+	TVRServiceNotAllowed            TVRFlag = 1<<8 | 0x10
+	TVRNewCard                      TVRFlag = 1<<8 | 0x08
+
+	// Byte 3
+	TVRCardholderVerificationNotSuccessful TVRFlag = 2<<8 | 0x80
+	TVRUnrecognisedCVM                     TVRFlag = 2<<8 | 0x40
+	TVRPINTryLimitExceeded                 TVRFlag = 2<<8 | 0x20
+	TVRPINPadNotPresentOrNotWorking        TVRFlag = 2<<8 | 0x10
+	TVRPINNotEntered                       TVRFlag = 2<<8 | 0x08
+	TVROnlinePINEntered                    TVRFlag = 2<<8 | 0x04
+
+	// Byte 4
+	TVRTransactionExceedsFloorLimit         TVRFlag = 3<<8 | 0x80
+	TVRLowerConsecutiveOfflineLimitExceeded TVRFlag = 3<<8 | 0x40
+	TVRUpperConsecutiveOfflineLimitExceeded TVRFlag = 3<<8 | 0x20
+	TVRSelectedRandomlyForOnline            TVRFlag = 3<<8 | 0x10
+	TVRMerchantForcedOnline                 TVRFlag = 3<<8 | 0x08
+
+	// Byte 5
+	TVRDefaultTDOLUsed                   TVRFlag = 4<<8 | 0x80
+	TVRIssuerAuthenticationFailed        TVRFlag = 4<<8 | 0x40
+	TVRScriptFailedBeforeFinalGenerateAC TVRFlag = 4<<8 | 0x20
+	TVRScriptFailedAfterFinalGenerateAC  TVRFlag = 4<<8 | 0x10
+	TVRRelayResistanceThresholdExceeded  TVRFlag = 4<<8 | 0x08
+	TVRRelayResistanceTimeLimitsExceeded TVRFlag = 4<<8 | 0x04
+)
+
+// tvrFlags lists the defined bits with their Annex C5 meaning, in TVR order
+var tvrFlags = []bitMeaning[TVRFlag]{
+	{TVROfflineDataAuthNotPerformed, "Offline data authentication was not performed"},
+	{TVRSDAFailed, "SDA failed"},
+	{TVRICCDataMissing, "ICC data missing"},
+	{TVRCardOnExceptionFile, "Card appears on terminal exception file"},
+	{TVRDDAFailed, "DDA failed"},
+	{TVRCDAFailed, "CDA failed"},
+	{TVRSDASelected, "SDA selected"},
+	{TVRDifferentApplicationVersions, "ICC and terminal have different application versions"},
+	{TVRExpiredApplication, "Expired application"},
+	{TVRApplicationNotYetEffective, "Application not yet effective"},
+	{TVRServiceNotAllowed, "Requested service not allowed for card product"},
+	{TVRNewCard, "New card"},
+	{TVRCardholderVerificationNotSuccessful, "Cardholder verification was not successful"},
+	{TVRUnrecognisedCVM, "Unrecognised CVM"},
+	{TVRPINTryLimitExceeded, "PIN Try Limit exceeded"},
+	{TVRPINPadNotPresentOrNotWorking, "PIN entry required and PIN pad not present or not working"},
+	{TVRPINNotEntered, "PIN entry required, PIN pad present, but PIN was not entered"},
+	{TVROnlinePINEntered, "Online PIN entered"},
+	{TVRTransactionExceedsFloorLimit, "Transaction exceeds floor limit"},
+	{TVRLowerConsecutiveOfflineLimitExceeded, "Lower consecutive offline limit exceeded"},
+	{TVRUpperConsecutiveOfflineLimitExceeded, "Upper consecutive offline limit exceeded"},
+	{TVRSelectedRandomlyForOnline, "Transaction selected randomly for online processing"},
+	{TVRMerchantForcedOnline, "Merchant forced transaction online"},
+	{TVRDefaultTDOLUsed, "Default TDOL used"},
+	{TVRIssuerAuthenticationFailed, "Issuer authentication failed"},
+	{TVRScriptFailedBeforeFinalGenerateAC, "Script processing failed before final GENERATE AC"},
+	{TVRScriptFailedAfterFinalGenerateAC, "Script processing failed after final GENERATE AC"},
+	{TVRRelayResistanceThresholdExceeded, "Relay resistance threshold exceeded"},
+	{TVRRelayResistanceTimeLimitsExceeded, "Relay resistance time limits exceeded"},
+}
+
+// NewTVR returns a five-byte TVR with the given bits set, for simulators and
+// tests
+func NewTVR(flags ...TVRFlag) TVR {
+	return make(TVR, 5).With(flags...)
+}
+
+// With sets the given bits in place and returns the TVR, growing it to five
+// bytes if needed
+func (t TVR) With(flags ...TVRFlag) TVR { return withBits(t, 5, flags) }
+
+// Has reports whether the bit flag is set
+func (t TVR) Has(flag TVRFlag) bool { return hasBit(t, flag) }
+
+// Flags returns the defined bits that are set, in TVR order
+func (t TVR) Flags() []TVRFlag { return setBits(t, tvrFlags) }
+
+// String lists the meaning of each bit that is set, separated by semicolons,
+// or returns "No TVR bits set"
+func (t TVR) String() string { return describeBits(t, tvrFlags, "No TVR bits set") }
+
+// Format implements fmt.Formatter, so %x and %X print the raw bytes and %s
+// and %v the meaning of the bits
+func (t TVR) Format(s fmt.State, verb rune) { formatBits(s, verb, t, t.String) }
+
+// String returns the Annex C5 meaning of the bit
+func (flag TVRFlag) String() string { return bitName(tvrFlags, flag) }
+
+// OfflineDataAuthNotPerformed reports byte 1 bit 8
+func (t TVR) OfflineDataAuthNotPerformed() bool { return t.Has(TVROfflineDataAuthNotPerformed) }
+
+// SDAFailed reports byte 1 bit 7
+func (t TVR) SDAFailed() bool { return t.Has(TVRSDAFailed) }
+
+// ICCDataMissing reports byte 1 bit 6
+func (t TVR) ICCDataMissing() bool { return t.Has(TVRICCDataMissing) }
+
+// CardOnExceptionFile reports byte 1 bit 5
+func (t TVR) CardOnExceptionFile() bool { return t.Has(TVRCardOnExceptionFile) }
+
+// DDAFailed reports byte 1 bit 4
+func (t TVR) DDAFailed() bool { return t.Has(TVRDDAFailed) }
+
+// CDAFailed reports byte 1 bit 3
+func (t TVR) CDAFailed() bool { return t.Has(TVRCDAFailed) }
+
+// SDASelected reports byte 1 bit 2
+func (t TVR) SDASelected() bool { return t.Has(TVRSDASelected) }
+
+// DifferentApplicationVersions reports byte 2 bit 8
+func (t TVR) DifferentApplicationVersions() bool { return t.Has(TVRDifferentApplicationVersions) }
+
+// ExpiredApplication reports byte 2 bit 7
+func (t TVR) ExpiredApplication() bool { return t.Has(TVRExpiredApplication) }
+
+// ApplicationNotYetEffective reports byte 2 bit 6
+func (t TVR) ApplicationNotYetEffective() bool { return t.Has(TVRApplicationNotYetEffective) }
+
+// ServiceNotAllowed reports byte 2 bit 5
+func (t TVR) ServiceNotAllowed() bool { return t.Has(TVRServiceNotAllowed) }
+
+// NewCard reports byte 2 bit 4
+func (t TVR) NewCard() bool { return t.Has(TVRNewCard) }
+
+// CardholderVerificationNotSuccessful reports byte 3 bit 8
+func (t TVR) CardholderVerificationNotSuccessful() bool {
+	return t.Has(TVRCardholderVerificationNotSuccessful)
+}
+
+// UnrecognisedCVM reports byte 3 bit 7
+func (t TVR) UnrecognisedCVM() bool { return t.Has(TVRUnrecognisedCVM) }
+
+// PINTryLimitExceeded reports byte 3 bit 6
+func (t TVR) PINTryLimitExceeded() bool { return t.Has(TVRPINTryLimitExceeded) }
+
+// PINPadNotPresentOrNotWorking reports byte 3 bit 5
+func (t TVR) PINPadNotPresentOrNotWorking() bool { return t.Has(TVRPINPadNotPresentOrNotWorking) }
+
+// PINNotEntered reports byte 3 bit 4
+func (t TVR) PINNotEntered() bool { return t.Has(TVRPINNotEntered) }
+
+// OnlinePINEntered reports byte 3 bit 3
+func (t TVR) OnlinePINEntered() bool { return t.Has(TVROnlinePINEntered) }
+
+// TransactionExceedsFloorLimit reports byte 4 bit 8
+func (t TVR) TransactionExceedsFloorLimit() bool { return t.Has(TVRTransactionExceedsFloorLimit) }
+
+// LowerConsecutiveOfflineLimitExceeded reports byte 4 bit 7
+func (t TVR) LowerConsecutiveOfflineLimitExceeded() bool {
+	return t.Has(TVRLowerConsecutiveOfflineLimitExceeded)
+}
+
+// UpperConsecutiveOfflineLimitExceeded reports byte 4 bit 6
+func (t TVR) UpperConsecutiveOfflineLimitExceeded() bool {
+	return t.Has(TVRUpperConsecutiveOfflineLimitExceeded)
+}
+
+// SelectedRandomlyForOnline reports byte 4 bit 5
+func (t TVR) SelectedRandomlyForOnline() bool { return t.Has(TVRSelectedRandomlyForOnline) }
+
+// MerchantForcedOnline reports byte 4 bit 4
+func (t TVR) MerchantForcedOnline() bool { return t.Has(TVRMerchantForcedOnline) }
+
+// DefaultTDOLUsed reports byte 5 bit 8
+func (t TVR) DefaultTDOLUsed() bool { return t.Has(TVRDefaultTDOLUsed) }
+
+// IssuerAuthenticationFailed reports byte 5 bit 7
+func (t TVR) IssuerAuthenticationFailed() bool { return t.Has(TVRIssuerAuthenticationFailed) }
+
+// ScriptFailedBeforeFinalGenerateAC reports byte 5 bit 6
+func (t TVR) ScriptFailedBeforeFinalGenerateAC() bool {
+	return t.Has(TVRScriptFailedBeforeFinalGenerateAC)
+}
+
+// ScriptFailedAfterFinalGenerateAC reports byte 5 bit 5
+func (t TVR) ScriptFailedAfterFinalGenerateAC() bool {
+	return t.Has(TVRScriptFailedAfterFinalGenerateAC)
+}
+
+// RelayResistanceThresholdExceeded reports byte 5 bit 4
+func (t TVR) RelayResistanceThresholdExceeded() bool {
+	return t.Has(TVRRelayResistanceThresholdExceeded)
+}
+
+// RelayResistanceTimeLimitsExceeded reports byte 5 bit 3
+func (t TVR) RelayResistanceTimeLimitsExceeded() bool {
+	return t.Has(TVRRelayResistanceTimeLimitsExceeded)
+}
+
+// RelayResistancePerformed returns the two-bit field in byte 5 bits 2-1:
+// 0 when the relay resistance protocol is not supported, 1 when it was not
+// performed, 2 when it was performed and 3 (RFU)
+func (t TVR) RelayResistancePerformed() byte {
+	if len(t) < 5 {
+		return 0
+	}
+	return t[4] & 0x03
+}
@@ -0,0 +1,89 @@
+package emvparser
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestTVR(t *testing.T) {
+	tvr := TVR(mustDecodeHex(t, "8440800800"))
+
+	tests := []struct {
+		name     string
+		got      bool
+		expected bool
+	}{
+		{"OfflineDataAuthNotPerformed", tvr.OfflineDataAuthNotPerformed(), true},
+		{"CDAFailed", tvr.CDAFailed(), true},
+		{"DDAFailed", tvr.DDAFailed(), false},
+		{"ExpiredApplication", tvr.ExpiredApplication(), true},
+		{"NewCard", tvr.NewCard(), false},
+		{"CardholderVerificationNotSuccessful", tvr.CardholderVerificationNotSuccessful(), true},
+		{"TransactionExceedsFloorLimit", tvr.TransactionExceedsFloorLimit(), false},
+		{"MerchantForcedOnline", tvr.MerchantForcedOnline(), true},
+		{"DefaultTDOLUsed", tvr.DefaultTDOLUsed(), false},
+		{"RelayResistancePerformed", tvr.RelayResistancePerformed() == 0, true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	expected := "Offline data authentication was not performed; CDA failed; Expired application; " +
+		"Cardholder verification was not successful; Merchant forced transaction online"
+	if got := tvr.String(); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+	if got := fmt.Sprintf("%s", tvr); got != expected {
+		t.Errorf("Expected %%s to describe the bits, got: %q", got)
+	}
+	if got := TVR(nil).String(); got != "No TVR bits set" {
+		t.Errorf("Expected an empty TVR to say so, got: %q", got)
+	}
+
+	// The hex verbs print the raw bytes, as they did for []byte
+	for _, format := range []string{"%X", "%x", "% X", "%08X"} {
+		if got, expected := fmt.Sprintf(format, tvr), fmt.Sprintf(format, []byte(tvr)); got != expected {
+			t.Errorf("%s: expected %s, got: %s", format, expected, got)
+		}
+	}
+
+	// Short values read as zero-padded
+	if short := (TVR{0x80}); short.DefaultTDOLUsed() || !short.OfflineDataAuthNotPerformed() {
+		t.Errorf("Expected a short TVR to read as zero-padded")
+	}
+}
+
+func TestNewTVR(t *testing.T) {
+	tvr := NewTVR(TVRSDASelected, TVRPINNotEntered, TVRTransactionExceedsFloorLimit, TVRRelayResistanceTimeLimitsExceeded)
+	if got := fmt.Sprintf("%X", tvr); got != "0200088004" {
+		t.Errorf("Expected 0200088004, got: %s", got)
+	}
+	if performed := (TVR{0, 0, 0, 0, 0x0A}).RelayResistancePerformed(); performed != 2 {
+		t.Errorf("Expected relay resistance performed to be 2, got: %d", performed)
+	}
+	if flags := tvr.Flags(); !slices.Equal(flags, []TVRFlag{TVRSDASelected, TVRPINNotEntered, TVRTransactionExceedsFloorLimit, TVRRelayResistanceTimeLimitsExceeded}) {
+		t.Errorf("Unexpected flags: %v", flags)
+	}
+
+	// With grows a short TVR
+	if got := fmt.Sprintf("%X", (TVR{0x80}).With(TVRDefaultTDOLUsed)); got != "8000000080" {
+		t.Errorf("Expected 8000000080, got: %s", got)
+	}
+
+	// A built TVR round trips through Marshal and Parse
+	parser := NewEMVParser()
+	encoded, err := parser.Marshal(&EMVData{TerminalVerificationResults: tvr})
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	parsed, err := parser.Parse(encoded)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if !parsed.TerminalVerificationResults.PINNotEntered() {
+		t.Errorf("Expected PINNotEntered after a round trip, got: %s", parsed.TerminalVerificationResults)
+	}
+}
@@ -0,0 +1,161 @@
+package emvparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Kinds of values that do not match the format of their tag, reported in a
+// ValidationError. Use errors.Is to test for them.
+var (
+	// ErrValueLength means a value is shorter than MinLength or longer than
+	// MaxLength
+	ErrValueLength = errors.New("value length out of range")
+
+	// ErrInvalidNumeric means an n value holds a nibble other than 0-9
+	ErrInvalidNumeric = errors.New("invalid numeric (n) value")
+
+	// ErrInvalidCompressedNumeric means a cn value holds a nibble other than
+	// 0-9, or a digit after the trailing F padding
+	ErrInvalidCompressedNumeric = errors.New("invalid compressed numeric (cn) value")
+
+	// ErrInvalidCharacter means an a, an or ans value holds a character
+	// outside the set its format allows
+	ErrInvalidCharacter = errors.New("invalid character")
+)
+
+// ValidationError describes a value that does not match the length range or
+// the EMV data format of its tag
+type ValidationError struct {
+	// Offset is the byte offset in the input of the data object's tag
+	Offset int
+
+	// Tag is the tag of the data object
+	Tag string
+
+	// Path lists the templates enclosing the data object, empty at the top
+	// level
+	Path string
+
+	// Err describes the problem and wraps its kind, such as ErrValueLength
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("%v at offset %d (tag %s", e.Err, e.Offset, e.Tag)
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	return msg + ")"
+}
+
+// Unwrap returns the problem, so errors.Is works with the sentinel errors
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks every primitive data object in the tree whose tag is in
+// registry against its length range and EMV data format, returning all
+// violations in input order. Tags that are not in registry, b values and
+// templates are not checked. A nil registry selects DefaultTagRegistry.
+func (l TLVList) Validate(registry *TagRegistry) []*ValidationError {
+	if registry == nil {
+		registry = DefaultTagRegistry
+	}
+	return l.validate(registry, "", nil)
+}
+
+// validate appends the violations in the list, which sits in the templates
+// listed in path, to violations
+func (l TLVList) validate(registry *TagRegistry, path string, violations []*ValidationError) []*ValidationError {
+	for _, node := range l {
+		if node.Constructed() {
+			childPath := node.Tag
+			if path != "" {
+				childPath = path + "/" + node.Tag
+			}
+			violations = node.Children.validate(registry, childPath, violations)
+			continue
+		}
+
+		format, ok := registry.lookup(node.Tag)
+		if !ok {
+			continue
+		}
+		if err := validateValue(node.Value, format); err != nil {
+			violations = append(violations, &ValidationError{Offset: node.Offset, Tag: node.Tag, Path: path, Err: err})
+		}
+	}
+	return violations
+}
+
+// validateValue checks value against the length range and the EMV data
+// format of EMV Book 3 section 4.3:
+//
+//   - n values are BCD, right justified and padded with leading zeros
+//   - cn values are BCD, left justified and padded with trailing F nibbles
+//   - a values hold letters, an values letters and digits, and ans values
+//     any printable ASCII character; a and an values may be padded with
+//     trailing spaces
+//   - b values and var templates may hold anything
+func validateValue(value []byte, format EMVTagFormat) error {
+	if len(value) < format.MinLength || (format.MaxLength > 0 && len(value) > format.MaxLength) {
+		if format.MinLength == format.MaxLength {
+			return fmt.Errorf("%w: %d bytes, expected %d", ErrValueLength, len(value), format.MinLength)
+		}
+		return fmt.Errorf("%w: %d bytes, expected %d to %d", ErrValueLength, len(value), format.MinLength, format.MaxLength)
+	}
+
+	switch format.Format {
+	case "n":
+		for i, c := range value {
+			if c>>4 > 9 || c&0x0F > 9 {
+				return fmt.Errorf("%w: byte %02X at position %d", ErrInvalidNumeric, c, i)
+			}
+		}
+
+	case "cn":
+		padding := false
+		for i := range len(value) * 2 {
+			nibble := value[i/2] >> 4
+			if i%2 == 1 {
+				nibble = value[i/2] & 0x0F
+			}
+			switch {
+			case nibble == 0x0F:
+				padding = true
+			case nibble > 9 || padding:
+				return fmt.Errorf("%w: byte %02X at position %d", ErrInvalidCompressedNumeric, value[i/2], i/2)
+			}
+		}
+
+	case "a", "an", "ans":
+		if format.Format != "ans" {
+			// Trailing spaces are padding
+			value = bytes.TrimRight(value, " ")
+		}
+		for i, c := range value {
+			if !validCharacter(c, format.Format) {
+				return fmt.Errorf("%w %q at position %d for format %s", ErrInvalidCharacter, c, i, format.Format)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validCharacter reports whether c belongs to the character set of the a, an
+// or ans format
+func validCharacter(c byte, format string) bool {
+	letter := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+	digit := c >= '0' && c <= '9'
+
+	switch format {
+	case "a":
+		return letter
+	case "an":
+		return letter || digit
+	}
+	return c >= 0x20 && c <= 0x7E
+}
@@ -0,0 +1,103 @@
+package emvparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		tag   string
+		value string
+		kind  error
+	}{
+		{"b of the right length", "9F26", "D0C669EEB70C58DD", nil},
+		{"b too short", "9F26", "D0C669", ErrValueLength},
+		{"n", "9F02", "000000001000", nil},
+		{"n with a hex digit", "9F02", "00000000100A", ErrInvalidNumeric},
+		{"n too long", "9F02", "00000000000010", ErrValueLength},
+		{"cn with F padding", "5A", "4761739001010119FFFF", nil},
+		{"cn without padding", "5A", "4761739001010119", nil},
+		{"cn with a digit after the padding", "5A", "47617390010101F9", ErrInvalidCompressedNumeric},
+		{"cn with a hex digit", "5A", "4761739001010A19", ErrInvalidCompressedNumeric},
+		{"a", "5F55", "5553", nil},
+		{"a with a digit", "5F55", "5531", ErrInvalidCharacter},
+		{"an", "5F2D", "656E6672", nil},
+		{"an with a space", "5F2D", "656E2066", ErrInvalidCharacter},
+		{"ans", "5F20", "43415244484F4C4445522F56495341", nil},
+		{"ans with a control character", "5F20", "434152440A", ErrInvalidCharacter},
+		{"b holds anything", "57", "FF00", nil},
+	}
+
+	for _, tt := range tests {
+		err := validateValue(mustDecodeHex(t, tt.value), DefaultTagRegistry.Format(tt.tag))
+		if tt.kind == nil && err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.name, err)
+		} else if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.kind, err)
+		}
+	}
+}
+
+func TestValidateTree(t *testing.T) {
+	// A 3-byte 9F26, a non-BCD 9F02 inside 77 and a valid 9F36
+	nodes, err := DecodeTree(mustDecodeHex(t, "9F2603D0C669"+"77099F020600000000100A"+"9F36020001"))
+	if err != nil {
+		t.Fatalf("Error decoding TLV tree: %v", err)
+	}
+
+	expected := []struct {
+		tag    string
+		offset int
+		path   string
+		kind   error
+	}{
+		{"9F26", 0, "", ErrValueLength},
+		{"9F02", 8, "77", ErrInvalidNumeric},
+	}
+
+	violations := nodes.Validate(nil)
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got: %v", len(expected), violations)
+	}
+	for i, want := range expected {
+		v := violations[i]
+		if v.Tag != want.tag || v.Offset != want.offset || v.Path != want.path || !errors.Is(v, want.kind) {
+			t.Errorf("Violation %d: expected %v for %s at offset %d in %q, got: %v", i, want.kind, want.tag, want.offset, want.path, v)
+		}
+	}
+}
+
+func TestParseWithValidation(t *testing.T) {
+	data := mustDecodeHex(t, "9F2603D0C669"+"9F020600000000100A"+"9F36020001")
+
+	parsed, err := NewEMVParser().Parse(data)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if len(parsed.Violations) != 0 {
+		t.Errorf("Expected no validation without WithValidation, got: %v", parsed.Violations)
+	}
+
+	parsed, err = NewEMVParser(WithValidation()).Parse(data)
+	if err != nil {
+		t.Fatalf("Error parsing EMV data: %v", err)
+	}
+	if len(parsed.Violations) != 2 || !errors.Is(parsed.Violations[0], ErrValueLength) || !errors.Is(parsed.Violations[1], ErrInvalidNumeric) {
+		t.Fatalf("Expected a length and a numeric violation, got: %v", parsed.Violations)
+	}
+	if parsed.Violations[1].Offset != 6 {
+		t.Errorf("Expected the 9F02 violation at offset 6, got: %d", parsed.Violations[1].Offset)
+	}
+
+	// Invalid values are still parsed
+	if !bytesEqual(parsed.ApplicationCryptogram, mustDecodeHex(t, "D0C669")) {
+		t.Errorf("Expected the short cryptogram to be kept, got: %X", parsed.ApplicationCryptogram)
+	}
+
+	msg := parsed.Violations[0].Error()
+	if msg != "value length out of range: 3 bytes, expected 8 at offset 0 (tag 9F26)" {
+		t.Errorf("Unexpected message: %s", msg)
+	}
+}
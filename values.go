@@ -0,0 +1,368 @@
+package emvparser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// decoderFunc stores a raw EMV value in a struct field of the type it was
+// chosen for
+type decoderFunc func(field reflect.Value, value []byte, format EMVTagFormat) error
+
+// valueDecoder returns the decoderFunc for struct fields of type t. Types
+// implementing EMVUnmarshaler decode the value themselves; other types are
+// converted according to the field's kind and the tag's EMV format:
+//
+//   - []byte receives the raw value
+//   - string receives the digits of n and cn values and the raw characters
+//     of every other format
+//   - integers are decoded from BCD for n values and as big-endian binary
+//     otherwise
+//   - time.Time is decoded from an n YYMMDD date
+//   - bool is true when any byte of the value is non-zero
+//   - byte arrays receive the raw value, which must fill the array
+//
+// The choice only depends on t, so it is made once per field and cached with
+// the other field metadata.
+func valueDecoder(t reflect.Type) decoderFunc {
+	if t.Kind() == reflect.Ptr && t.Implements(unmarshalerType) {
+		return decodePtrUnmarshaler
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return decodeAddrUnmarshaler
+	}
+	if t == timeType {
+		return decodeTime
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return decodeBytes
+		}
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return decodeByteArray
+		}
+	case reflect.String:
+		return decodeString
+	case reflect.Bool:
+		return decodeBool
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return decodeUintField
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return decodeIntField
+	}
+
+	return decodeUnsupported
+}
+
+// decodePtrUnmarshaler decodes into a pointer field whose type implements
+// EMVUnmarshaler, allocating its target first if needed
+func decodePtrUnmarshaler(field reflect.Value, value []byte, _ EMVTagFormat) error {
+	if field.IsNil() {
+		field.Set(reflect.New(field.Type().Elem()))
+	}
+	return field.Interface().(EMVUnmarshaler).UnmarshalEMV(value)
+}
+
+// decodeAddrUnmarshaler decodes into a field whose pointer type implements
+// EMVUnmarshaler
+func decodeAddrUnmarshaler(field reflect.Value, value []byte, _ EMVTagFormat) error {
+	if !field.CanAddr() {
+		return fmt.Errorf("unaddressable field of type %s", field.Type())
+	}
+	return field.Addr().Interface().(EMVUnmarshaler).UnmarshalEMV(value)
+}
+
+func decodeTime(field reflect.Value, value []byte, _ EMVTagFormat) error {
+	t, err := decodeDate(value)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func decodeBytes(field reflect.Value, value []byte, _ EMVTagFormat) error {
+	field.SetBytes(value)
+	return nil
+}
+
+func decodeByteArray(field reflect.Value, value []byte, _ EMVTagFormat) error {
+	if len(value) != field.Len() {
+		return fmt.Errorf("expected %d bytes, got %d", field.Len(), len(value))
+	}
+	reflect.Copy(field, reflect.ValueOf(value))
+	return nil
+}
+
+func decodeString(field reflect.Value, value []byte, format EMVTagFormat) error {
+	switch format.Format {
+	case "n":
+		digits, err := decodeBCD(value)
+		if err != nil {
+			return err
+		}
+		field.SetString(digits)
+	case "cn":
+		field.SetString(strings.TrimRight(fmt.Sprintf("%X", value), "F"))
+	default:
+		field.SetString(string(value))
+	}
+	return nil
+}
+
+func decodeBool(field reflect.Value, value []byte, _ EMVTagFormat) error {
+	b := false
+	for _, c := range value {
+		b = b || c != 0
+	}
+	field.SetBool(b)
+	return nil
+}
+
+func decodeUintField(field reflect.Value, value []byte, format EMVTagFormat) error {
+	n, err := decodeUint(value, format)
+	if err != nil {
+		return err
+	}
+	if field.OverflowUint(n) {
+		return fmt.Errorf("value %d overflows %s", n, field.Type())
+	}
+	field.SetUint(n)
+	return nil
+}
+
+func decodeIntField(field reflect.Value, value []byte, format EMVTagFormat) error {
+	n, err := decodeUint(value, format)
+	if err != nil {
+		return err
+	}
+	if n > 1<<63-1 || field.OverflowInt(int64(n)) {
+		return fmt.Errorf("value %d overflows %s", n, field.Type())
+	}
+	field.SetInt(int64(n))
+	return nil
+}
+
+func decodeUnsupported(field reflect.Value, _ []byte, _ EMVTagFormat) error {
+	return fmt.Errorf("unsupported field type %s", field.Type())
+}
+
+// encodeValue returns the raw EMV value held in a struct field. It is the
+// inverse of valueDecoder: types implementing EMVMarshaler encode themselves,
+// n strings and n and b integers are encoded with the tag's MaxLength, and
+// cn strings with as many bytes as their digits need.
+func encodeValue(field reflect.Value, format EMVTagFormat) ([]byte, error) {
+	if field.Type().Implements(marshalerType) {
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			return nil, nil
+		}
+		return field.Interface().(EMVMarshaler).MarshalEMV()
+	}
+	if field.CanAddr() && field.Addr().Type().Implements(marshalerType) {
+		return field.Addr().Interface().(EMVMarshaler).MarshalEMV()
+	}
+
+	if field.Type() == timeType {
+		t := field.Interface().(time.Time)
+		if t.IsZero() {
+			return nil, nil
+		}
+		return encodeDate(t)
+	}
+
+	switch field.Kind() {
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		return field.Bytes(), nil
+
+	case reflect.Array:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		value := make([]byte, field.Len())
+		reflect.Copy(reflect.ValueOf(value), field)
+		return value, nil
+
+	case reflect.String:
+		switch format.Format {
+		case "n":
+			return encodeBCD(field.String(), format.MaxLength, true)
+		case "cn":
+			// cn values vary in length, so only an odd digit is padded here
+			// and formatValueForTag pads to MinLength
+			return encodeBCD(field.String(), 0, false)
+		default:
+			return []byte(field.String()), nil
+		}
+
+	case reflect.Bool:
+		if field.Bool() {
+			return []byte{0x01}, nil
+		}
+		return []byte{0x00}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return encodeUint(field.Uint(), format)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Int() < 0 {
+			return nil, fmt.Errorf("negative value %d cannot be encoded", field.Int())
+		}
+		return encodeUint(uint64(field.Int()), format)
+	}
+
+	return nil, fmt.Errorf("unsupported field type %s", field.Type())
+}
+
+// decodeUint decodes an unsigned integer from a BCD (n) or big-endian binary value
+func decodeUint(value []byte, format EMVTagFormat) (uint64, error) {
+	if format.Format == "n" {
+		digits, err := decodeBCD(value)
+		if err != nil {
+			return 0, err
+		}
+
+		var n uint64
+		for _, d := range digits {
+			if n > (1<<64-1-uint64(d-'0'))/10 {
+				return 0, fmt.Errorf("numeric value %s overflows uint64", digits)
+			}
+			n = n*10 + uint64(d-'0')
+		}
+		return n, nil
+	}
+
+	if len(value) > 8 {
+		// Leading zero bytes do not change the value
+		for _, c := range value[:len(value)-8] {
+			if c != 0 {
+				return 0, fmt.Errorf("binary value of %d bytes overflows uint64", len(value))
+			}
+		}
+		value = value[len(value)-8:]
+	}
+
+	var n uint64
+	for _, c := range value {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// encodeUint encodes an unsigned integer as BCD (n) or big-endian binary. The
+// result is MaxLength bytes long when the format has one, otherwise as short
+// as possible.
+func encodeUint(n uint64, format EMVTagFormat) ([]byte, error) {
+	if format.Format == "n" {
+		return encodeBCD(fmt.Sprintf("%d", n), format.MaxLength, true)
+	}
+
+	size := format.MaxLength
+	if size == 0 {
+		size = 1
+		for v := n >> 8; v > 0; v >>= 8 {
+			size++
+		}
+	}
+
+	if size < 8 && n>>(uint(size)*8) != 0 {
+		return nil, fmt.Errorf("value %d does not fit in %d bytes", n, size)
+	}
+
+	value := make([]byte, size)
+	for i := size - 1; i >= 0 && n > 0; i-- {
+		value[i] = byte(n)
+		n >>= 8
+	}
+	return value, nil
+}
+
+// decodeBCD returns the decimal digits of an n (BCD) value
+func decodeBCD(value []byte) (string, error) {
+	digits := make([]byte, 0, len(value)*2)
+	for _, c := range value {
+		hi, lo := c>>4, c&0x0F
+		if hi > 9 || lo > 9 {
+			return "", fmt.Errorf("invalid BCD byte %02X", c)
+		}
+		digits = append(digits, '0'+hi, '0'+lo)
+	}
+	return string(digits), nil
+}
+
+// encodeBCD packs decimal digits two per byte. Numeric (n) values are padded
+// with leading zeros and compressed numeric (cn) values with trailing F
+// nibbles, to size bytes when size is non-zero.
+func encodeBCD(digits string, size int, numeric bool) ([]byte, error) {
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return nil, fmt.Errorf("invalid digit %q in numeric value %q", digits[i], digits)
+		}
+	}
+
+	nibbles := len(digits) + len(digits)%2
+	if size > 0 {
+		if len(digits) > size*2 {
+			return nil, fmt.Errorf("numeric value %q does not fit in %d bytes", digits, size)
+		}
+		nibbles = size * 2
+	}
+
+	if numeric {
+		digits = strings.Repeat("0", nibbles-len(digits)) + digits
+	} else {
+		digits = digits + strings.Repeat("F", nibbles-len(digits))
+	}
+
+	value := make([]byte, nibbles/2)
+	for i := range value {
+		value[i] = hexNibble(digits[2*i])<<4 | hexNibble(digits[2*i+1])
+	}
+	return value, nil
+}
+
+// decodeDate decodes an n YYMMDD date. Years 00-49 are taken as 2000-2049
+// and 50-99 as 1950-1999, following EMV Book 4.
+func decodeDate(value []byte) (time.Time, error) {
+	if len(value) != 3 {
+		return time.Time{}, fmt.Errorf("expected a 3 byte YYMMDD date, got %d bytes", len(value))
+	}
+
+	digits, err := decodeBCD(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	year := int(digits[0]-'0')*10 + int(digits[1]-'0')
+	month := int(digits[2]-'0')*10 + int(digits[3]-'0')
+	day := int(digits[4]-'0')*10 + int(digits[5]-'0')
+
+	if year < 50 {
+		year += 2000
+	} else {
+		year += 1900
+	}
+
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if month < 1 || month > 12 || day < 1 || t.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %s", digits)
+	}
+	return t, nil
+}
+
+// encodeDate encodes a date as n YYMMDD
+func encodeDate(t time.Time) ([]byte, error) {
+	if t.Year() < 1950 || t.Year() > 2049 {
+		return nil, fmt.Errorf("year %d cannot be encoded as YY", t.Year())
+	}
+	return encodeBCD(t.Format("060102"), 3, true)
+}
@@ -0,0 +1,153 @@
+package emvparser
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testAmount int64
+
+// Authorization request using typed fields
+type testTypedAuthorization struct {
+	Amount      testAmount `emv:"9F02"`
+	OtherAmount string     `emv:"9F03"`
+	Date        time.Time  `emv:"9A"`
+	Expiry      time.Time  `emv:"5F24,omitempty"`
+	ATC         uint16     `emv:"9F36"`
+	Cryptogram  [8]byte    `emv:"9F26"`
+	Forced      bool       `emv:"DF01"`
+}
+
+func TestTypedFieldsRoundTrip(t *testing.T) {
+	data := mustDecodeHex(t, "9F02060000000123459F0306000000000100"+"9A032510165F24032812319F360200699F2608D0C669EEB70C58DDDF010101")
+
+	var auth testTypedAuthorization
+	if err := Unmarshal(data, &auth); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+
+	if auth.Amount != 12345 {
+		t.Errorf("Expected amount 12345, got: %d", auth.Amount)
+	}
+	if auth.OtherAmount != "000000000100" {
+		t.Errorf("Expected other amount 000000000100, got: %s", auth.OtherAmount)
+	}
+	if !auth.Date.Equal(time.Date(2025, time.October, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected transaction date 2025-10-16, got: %s", auth.Date)
+	}
+	if !auth.Expiry.Equal(time.Date(2028, time.December, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected expiration date 2028-12-31, got: %s", auth.Expiry)
+	}
+	if auth.ATC != 0x69 {
+		t.Errorf("Expected ATC 105, got: %d", auth.ATC)
+	}
+	if fmt.Sprintf("%X", auth.Cryptogram) != "D0C669EEB70C58DD" {
+		t.Errorf("Unexpected cryptogram: %X", auth.Cryptogram)
+	}
+	if !auth.Forced {
+		t.Errorf("Expected DF01 to decode as true")
+	}
+
+	encoded, err := Marshal(&auth)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if !bytesEqual(encoded, data) {
+		t.Errorf("Expected %X, got: %X", data, encoded)
+	}
+}
+
+func TestTypedFieldsEncoding(t *testing.T) {
+	auth := testTypedAuthorization{
+		Amount:      100,
+		OtherAmount: "5",
+		Date:        time.Date(2026, time.January, 2, 15, 4, 5, 0, time.UTC),
+		ATC:         0x0102,
+	}
+
+	encoded, err := Marshal(auth)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+
+	// Amounts are left padded BCD, the zero expiry date is omitted
+	expected := "9F02060000000001009F03060000000000059A032601029F360201029F2608" + "0000000000000000" + "DF010100"
+	if fmt.Sprintf("%X", encoded) != expected {
+		t.Errorf("Expected %s, got: %X", expected, encoded)
+	}
+}
+
+func TestTypedFieldErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"non-BCD amount", "9F02060000000A2345"},
+		{"invalid date", "9A03251332"},
+		{"short array", "9F2604D0C669EE"},
+		{"ATC overflow", "9F3603010000"},
+	}
+
+	for _, tt := range tests {
+		var auth testTypedAuthorization
+		if err := Unmarshal(mustDecodeHex(t, tt.data), &auth); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	if _, err := Marshal(testTypedAuthorization{Amount: -1}); err == nil {
+		t.Errorf("Expected an error for a negative amount")
+	}
+	if _, err := Marshal(testTypedAuthorization{OtherAmount: "12A"}); err == nil {
+		t.Errorf("Expected an error for a non-numeric string")
+	}
+}
+
+func TestCompressedNumericRoundTrip(t *testing.T) {
+	// An 8-byte PAN must not grow to the 10-byte MaxLength of 5A
+	data := mustDecodeHex(t, "5A084761739001010010")
+
+	var card struct {
+		PAN string `emv:"5A"`
+	}
+	if err := Unmarshal(data, &card); err != nil {
+		t.Fatalf("Error unmarshaling EMV data: %v", err)
+	}
+	if card.PAN != "4761739001010010" {
+		t.Errorf("Expected PAN 4761739001010010, got: %s", card.PAN)
+	}
+
+	encoded, err := Marshal(&card)
+	if err != nil {
+		t.Fatalf("Error marshaling EMV data: %v", err)
+	}
+	if !bytesEqual(encoded, data) {
+		t.Errorf("Expected %X, got: %X", data, encoded)
+	}
+}
+
+func TestEncodeBCD(t *testing.T) {
+	tests := []struct {
+		digits   string
+		size     int
+		numeric  bool
+		expected string
+	}{
+		{"840", 2, true, "0840"},
+		{"12345", 0, true, "012345"},
+		{"4761739001010010", 0, false, "4761739001010010"},
+		{"47617390010100101", 0, false, "47617390010100101F"},
+		{"123", 0, false, "123F"},
+	}
+
+	for _, tt := range tests {
+		value, err := encodeBCD(tt.digits, tt.size, tt.numeric)
+		if err != nil {
+			t.Fatalf("Error encoding %s: %v", tt.digits, err)
+		}
+		if fmt.Sprintf("%X", value) != tt.expected {
+			t.Errorf("Expected %s for %s, got: %X", tt.expected, tt.digits, value)
+		}
+	}
+}